@@ -3,6 +3,7 @@ package cmd
 import (
 	"bufio"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"os"
@@ -11,6 +12,7 @@ import (
 	"strings"
 
 	"github.com/cloudflare/cloudflare-go/v6"
+	"github.com/cloudflare/cloudflare-go/v6/accounts"
 	"github.com/cloudflare/cloudflare-go/v6/user"
 	log "github.com/sirupsen/logrus"
 	"golang.org/x/term"
@@ -22,14 +24,35 @@ import (
 )
 
 type tomlConfig struct {
-	Profiles map[string]profile `toml:"profiles"`
+	NestedSessions     string             `toml:"nested_sessions,omitempty"`
+	AuditHMAC          bool               `toml:"audit_hmac,omitempty"`
+	MaxSessionDuration string             `toml:"max_session_duration,omitempty"`
+	TokenNameTemplate  string             `toml:"token_name_template,omitempty"`
+	Profiles           map[string]profile `toml:"profiles"`
 }
 
 type profile struct {
-	Email           string   `toml:"email"`
-	AuthType        string   `toml:"auth_type"`
-	SessionDuration string   `toml:"session_duration,omitempty"`
-	Policies        []policy `toml:"policies,omitempty"`
+	Email               string       `toml:"email"`
+	AuthType            string       `toml:"auth_type"`
+	SessionDuration     string       `toml:"session_duration,omitempty"`
+	MaxSessionDuration  string       `toml:"max_session_duration,omitempty"`
+	AccountID           string       `toml:"account_id,omitempty"`
+	AccountName         string       `toml:"account_name,omitempty"`
+	ZoneID              string       `toml:"zone_id,omitempty"`
+	ZoneName            string       `toml:"zone_name,omitempty"`
+	TokenOwner          string       `toml:"token_owner,omitempty"`
+	TokenNameTemplate   string       `toml:"token_name_template,omitempty"`
+	AllowedIPs          []string     `toml:"allowed_ips,omitempty"`
+	DeniedIPs           []string     `toml:"denied_ips,omitempty"`
+	NestedSessions      string       `toml:"nested_sessions,omitempty"`
+	RequireConfirmation bool         `toml:"require_confirmation,omitempty"`
+	ConfirmationMessage string       `toml:"confirmation_message,omitempty"`
+	TOTP                bool         `toml:"totp,omitempty"`
+	AllowedWindow       *usageWindow `toml:"allowed_window,omitempty"`
+	Env                 *envMapping  `toml:"env,omitempty"`
+	Hooks               *hooks       `toml:"hooks,omitempty"`
+	Template            string       `toml:"template,omitempty"`
+	Policies            []policy     `toml:"policies,omitempty"`
 }
 
 type policy struct {
@@ -65,47 +88,78 @@ var addCmd = &cobra.Command{
 			keyring.Debug = true
 		}
 	},
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
 		profileName := strings.TrimSpace(args[0])
 		sessionDuration, _ := cmd.Flags().GetString("session-duration")
 		profileTemplate, _ := cmd.Flags().GetString("profile-template")
+		accountID, _ := cmd.Flags().GetString("account-id")
+		tokenOwner, _ := cmd.Flags().GetString("token-owner")
+		enableTOTP, _ := cmd.Flags().GetBool("enable-totp")
 
 		reader := bufio.NewReader(os.Stdin)
 		fmt.Print("Email address: ")
 		emailAddress, _ := reader.ReadString('\n')
 		emailAddress = strings.TrimSpace(emailAddress)
 
-		fmt.Print("Authentication value (API key or API token): ")
+		fmt.Print("Authentication value (API key, API token, Origin CA key or Access service token client ID): ")
 		byteAuthValue, err := term.ReadPassword(int(os.Stdin.Fd()))
 		if err != nil {
-			log.Fatal("unable to read authentication value: ", err)
+			return fmt.Errorf("unable to read authentication value: %w", err)
 		}
 		authValue := string(byteAuthValue)
 		fmt.Println()
 
 		authType, err := determineAuthType(strings.TrimSpace(authValue))
 		if err != nil {
-			log.Fatal("failed to detect authentication type: ", err)
+			return fmt.Errorf("failed to detect authentication type: %w", err)
+		}
+
+		if (authType == "access_service_token" || authType == "origin_ca_key") && (sessionDuration != "" || profileTemplate != "") {
+			return fmt.Errorf("%s credentials cannot be used to create short lived tokens, remove --session-duration and --profile-template", authType)
+		}
+
+		// Access service tokens are made up of two parts so we need to prompt for
+		// the client secret as well and store them together.
+		if authType == "access_service_token" {
+			fmt.Print("Access service token client secret: ")
+			byteClientSecret, err := term.ReadPassword(int(os.Stdin.Fd()))
+			if err != nil {
+				return fmt.Errorf("unable to read client secret: %w", err)
+			}
+			fmt.Println()
+
+			serviceToken, err := json.Marshal(accessServiceToken{
+				ClientID:     strings.TrimSpace(authValue),
+				ClientSecret: strings.TrimSpace(string(byteClientSecret)),
+			})
+			if err != nil {
+				return err
+			}
+			authValue = string(serviceToken)
 		}
 
 		configDir, err := resolveConfigDir()
 		if err != nil {
-			log.Fatal(err)
+			return err
 		}
 		configPath := filepath.Join(configDir, "config.toml")
 
+		if err := verifyPermissions(configDir); err != nil {
+			return err
+		}
+
 		os.MkdirAll(configDir, 0700)
 		if _, err := os.Stat(configPath); os.IsNotExist(err) {
-			file, err := os.Create(configPath)
+			file, err := os.OpenFile(configPath, os.O_RDWR|os.O_CREATE, 0600)
 			if err != nil {
-				log.Fatal(err)
+				return err
 			}
 			defer file.Close()
 		}
 
 		existingConfigFileContents, err := os.ReadFile(configPath)
 		if err != nil {
-			log.Fatal(err)
+			return err
 		}
 
 		tomlConfigStruct := tomlConfig{}
@@ -117,36 +171,70 @@ var addCmd = &cobra.Command{
 		}
 
 		newProfile := profile{
-			Email:    emailAddress,
-			AuthType: authType,
+			Email:      emailAddress,
+			AuthType:   authType,
+			AccountID:  accountID,
+			TokenOwner: tokenOwner,
+			TOTP:       enableTOTP,
 		}
 
 		if sessionDuration != "" {
 			newProfile.SessionDuration = sessionDuration
+			if err := validateSessionDuration(tomlConfigStruct, newProfile); err != nil {
+				return &configInvalidError{err: err}
+			}
 		} else {
 			log.Debug("session-duration was not set, not using short lived tokens")
 		}
 
 		var cfClient *cloudflare.Client
-		if profileTemplate != "" {
+		if authType == "api_token" || authType == "api_key" {
 			cfClient = newClient(authValue, authType, emailAddress)
 		}
 
-		if profileTemplate != "" {
+		// Offer to associate the profile with one of the accounts the credential
+		// can see. Not every credential is permitted to list accounts so a failure
+		// here isn't fatal.
+		if cfClient != nil && newProfile.AccountID == "" {
+			page, err := cfClient.Accounts.List(context.Background(), accounts.AccountListParams{})
+			if err != nil {
+				log.Debug("unable to list accounts: ", err)
+			} else if len(page.Result) > 0 {
+				newProfile.AccountID, err = promptAccount(reader, os.Stdout, page.Result)
+				if err != nil {
+					return err
+				}
+			}
+		}
+
+		if newProfile.TokenOwner == "account" && newProfile.AccountID == "" {
+			return errors.New("--token-owner account requires --account-id to be set")
+		}
+
+		// Remember which template generated the policies so it can be shown by
+		// `list`.
+		newProfile.Template = profileTemplate
+
+		if profileTemplate != "" && newProfile.TokenOwner == "account" {
+			generatedPolicy, err := generateAccountPolicy(context.Background(), cfClient, profileTemplate, newProfile.AccountID)
+			if err != nil {
+				return classifyAPIError(err)
+			}
+			newProfile.Policies = generatedPolicy
+		} else if profileTemplate != "" {
 			// The policies require that one of the resources is the current user.
 			// This leads to a potential chicken/egg scenario where the user doesn't
-			// valid credentials but needs them to generate the resources. We
-			// intentionally spit out `Debug` and `Fatal` messages here to show the
-			// original error *and* the friendly version of how to resolve it.
+			// valid credentials but needs them to generate the resources. The
+			// original error is included alongside the friendly version of how to
+			// resolve it.
 			userDetails, err := cfClient.User.Get(context.Background())
 			if err != nil {
-				log.Debug(err)
-				log.Fatal("failed to fetch user ID from the Cloudflare API which is required to generate the predefined short lived token policies. If you are using API tokens, please allow the permission to access your user details and try again.")
+				return classifyAPIError(fmt.Errorf("failed to fetch user ID from the Cloudflare API which is required to generate the predefined short lived token policies. If you are using API tokens, please allow the permission to access your user details and try again: %w", err))
 			}
 
 			generatedPolicy, err := generatePolicy(context.Background(), cfClient, profileTemplate, userDetails.ID)
 			if err != nil {
-				log.Fatal(err)
+				return classifyAPIError(err)
 			}
 			newProfile.Policies = generatedPolicy
 		}
@@ -154,18 +242,25 @@ var addCmd = &cobra.Command{
 		log.Debugf("new profile: %+v", newProfile)
 		tomlConfigStruct.Profiles[profileName] = newProfile
 
-		configFile, err := os.OpenFile(configPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0700)
+		configFile, err := os.OpenFile(configPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0600)
 		if err != nil {
-			log.Fatal("failed to open file at ", configPath)
+			return fmt.Errorf("failed to open file at %s", configPath)
 		}
 		defer configFile.Close()
 		if err := toml.NewEncoder(configFile).Encode(tomlConfigStruct); err != nil {
-			log.Fatal(err)
+			return err
 		}
 
 		ring, err := openKeyring()
 		if err != nil {
-			log.Fatalf("failed to open keyring backend: %s", strings.ToLower(err.Error()))
+			return &keyringUnavailableError{err: fmt.Errorf("failed to open keyring backend: %s", strings.ToLower(err.Error()))}
+		}
+
+		if tomlConfigStruct.AuditHMAC {
+			auditHMACRequired = true
+			if err := useAuditKey(ring); err != nil {
+				log.Warnf("failed to load audit HMAC key: %s", err)
+			}
 		}
 
 		resp := ring.Set(keyring.Item{
@@ -173,24 +268,57 @@ var addCmd = &cobra.Command{
 			Data: []byte(authValue),
 		})
 
-		if resp == nil {
-			fmt.Println("\nSuccess! Credentials have been set and are now ready for use!")
-		} else {
+		if resp != nil {
 			// error of some sort
-			log.Fatal("Error adding credentials to keyring: ", resp)
+			return &keyringUnavailableError{err: fmt.Errorf("failed to add credentials to keyring: %w", resp)}
+		}
+
+		if enableTOTP {
+			secret, err := generateTOTPSecret()
+			if err != nil {
+				return fmt.Errorf("failed to generate TOTP secret: %w", err)
+			}
+			if err := ring.Set(keyring.Item{Key: totpKeyringKey(profileName), Data: []byte(secret)}); err != nil {
+				return &keyringUnavailableError{err: fmt.Errorf("failed to add TOTP secret to keyring: %w", err)}
+			}
+			fmt.Println("\nAdd this URI to your authenticator app, a code from it is now required to use this profile:")
+			fmt.Println(totpURI(profileName, secret))
 		}
+
+		appendAuditRecord(auditRecord{
+			Event:   auditEventAdd,
+			Profile: profileName,
+			Command: redactCommandLine(os.Args, []string{authValue}),
+		})
+
+		fmt.Println("\nSuccess! Credentials have been set and are now ready for use!")
+
+		return nil
 	},
 }
 
+// accessServiceToken is the keyring representation of a Cloudflare Access
+// service token.
+type accessServiceToken struct {
+	ClientID     string `json:"client_id"`
+	ClientSecret string `json:"client_secret"`
+}
+
 func determineAuthType(s string) (string, error) {
-	if apiTokenMatch, _ := regexp.MatchString("[A-Za-z0-9-_]{40}", s); apiTokenMatch {
+	if originCAKeyMatch, _ := regexp.MatchString(`^v1\.0-[0-9a-f]+-[0-9a-f]+$`, s); originCAKeyMatch {
+		log.Debug("Origin CA key detected")
+		return "origin_ca_key", nil
+	} else if accessClientIDMatch, _ := regexp.MatchString(`^[0-9a-f]{32}\.access$`, s); accessClientIDMatch {
+		log.Debug("Access service token client ID detected")
+		return "access_service_token", nil
+	} else if apiTokenMatch, _ := regexp.MatchString("[A-Za-z0-9-_]{40}", s); apiTokenMatch {
 		log.Debug("API token detected")
 		return "api_token", nil
 	} else if apiKeyMatch, _ := regexp.MatchString("[0-9a-f]{37}", s); apiKeyMatch {
 		log.Debug("API key detected")
 		return "api_key", nil
 	} else {
-		return "", errors.New("invalid API token or API key format")
+		return "", errors.New("invalid API token, API key, Origin CA key or Access service token client ID format")
 	}
 }
 
@@ -215,15 +343,8 @@ func generatePolicy(ctx context.Context, client *cloudflare.Client, policyType,
 		}
 	}
 
-	switch policyType {
-	case "read-only":
-		accountGroups = filterReadGroups(accountGroups)
-		zoneGroups = filterReadGroups(zoneGroups)
-		userGroups = filterReadGroups(userGroups)
-	case "write-everything":
-		// use all groups as-is
-	default:
-		return nil, fmt.Errorf("unable to generate policy for %q, valid policy names: [read-only, write-everything]", policyType)
+	if err := applyPolicyTemplate(policyType, &accountGroups, &zoneGroups, &userGroups); err != nil {
+		return nil, err
 	}
 
 	if len(accountGroups) == 0 || len(zoneGroups) == 0 || len(userGroups) == 0 {
@@ -249,6 +370,72 @@ func generatePolicy(ctx context.Context, client *cloudflare.Client, policyType,
 	}, nil
 }
 
+// generateAccountPolicy is the equivalent of generatePolicy for account owned
+// tokens. Permission groups come from the account endpoint and the policies are
+// scoped to the single account as account owned tokens cannot access user
+// resources or other accounts.
+func generateAccountPolicy(ctx context.Context, client *cloudflare.Client, policyType, accountID string) ([]policy, error) {
+	page, err := client.Accounts.Tokens.PermissionGroups.List(ctx, accounts.TokenPermissionGroupListParams{
+		AccountID: cloudflare.F(accountID),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch account permission groups: %w", err)
+	}
+
+	var accountGroups, zoneGroups []permissionGroup
+	for _, g := range page.Result {
+		for _, scope := range g.Scopes {
+			pg := permissionGroup{ID: g.ID, Name: g.Name}
+			switch scope {
+			case accounts.TokenPermissionGroupListResponseScopeComCloudflareAPIAccountZone:
+				zoneGroups = append(zoneGroups, pg)
+			case accounts.TokenPermissionGroupListResponseScopeComCloudflareAPIAccount:
+				accountGroups = append(accountGroups, pg)
+			}
+		}
+	}
+
+	if err := applyPolicyTemplate(policyType, &accountGroups, &zoneGroups); err != nil {
+		return nil, err
+	}
+
+	if len(accountGroups) == 0 || len(zoneGroups) == 0 {
+		return nil, fmt.Errorf("one or more policy buckets is empty for policy type %q (account=%d, zone=%d); check API permissions", policyType, len(accountGroups), len(zoneGroups))
+	}
+
+	accountResource := "com.cloudflare.api.account." + accountID
+	return []policy{
+		{
+			Effect:           "allow",
+			Resources:        map[string]interface{}{accountResource: "*"},
+			PermissionGroups: accountGroups,
+		},
+		{
+			Effect: "allow",
+			Resources: map[string]interface{}{
+				accountResource: map[string]interface{}{"com.cloudflare.api.account.zone.*": "*"},
+			},
+			PermissionGroups: zoneGroups,
+		},
+	}, nil
+}
+
+// applyPolicyTemplate filters each of the permission group buckets according
+// to the predefined policy template.
+func applyPolicyTemplate(policyType string, buckets ...*[]permissionGroup) error {
+	switch policyType {
+	case "read-only":
+		for _, b := range buckets {
+			*b = filterReadGroups(*b)
+		}
+	case "write-everything":
+		// use all groups as-is
+	default:
+		return fmt.Errorf("unable to generate policy for %q, valid policy names: [read-only, write-everything]", policyType)
+	}
+	return nil
+}
+
 func filterReadGroups(groups []permissionGroup) []permissionGroup {
 	var out []permissionGroup
 	for _, g := range groups {
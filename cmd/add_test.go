@@ -275,3 +275,68 @@ func TestGeneratePolicy_APIError(t *testing.T) {
 		t.Fatal("expected error for API 500 response, got nil")
 	}
 }
+
+func TestDetermineAuthType_AccessServiceToken(t *testing.T) {
+	clientID := "0123456789abcdef0123456789abcdef.access"
+	got, err := determineAuthType(clientID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "access_service_token" {
+		t.Errorf("expected access_service_token, got %s", got)
+	}
+}
+
+func TestDetermineAuthType_OriginCAKey(t *testing.T) {
+	key := "v1.0-0123456789abcdef01234567-" + strings.Repeat("0123456789abcdef", 9) + "01"
+	got, err := determineAuthType(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "origin_ca_key" {
+		t.Errorf("expected origin_ca_key, got %s", got)
+	}
+}
+
+func TestGenerateAccountPolicy_ReadOnly(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/accounts/acct-123/tokens/permission_groups", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(permGroupResponse{
+			Success:  true,
+			Errors:   []interface{}{},
+			Messages: []interface{}{},
+			Result:   representativeGroups,
+		})
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	client := newTestClient(t, srv.URL)
+
+	policies, err := generateAccountPolicy(context.Background(), client, "read-only", "acct-123")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(policies) != 2 {
+		t.Fatalf("expected 2 policies, got %d", len(policies))
+	}
+
+	for _, p := range policies {
+		for _, g := range p.PermissionGroups {
+			if !strings.Contains(g.Name, "Read") {
+				t.Errorf("read-only policy contains non-Read group %q", g.Name)
+			}
+			if g.ID == "user-token-read" {
+				t.Error("user scoped groups must not appear in account owned policies")
+			}
+		}
+	}
+
+	if policies[0].Resources["com.cloudflare.api.account.acct-123"] != "*" {
+		t.Errorf("expected account policy scoped to acct-123, got %v", policies[0].Resources)
+	}
+	zoneResources, ok := policies[1].Resources["com.cloudflare.api.account.acct-123"].(map[string]interface{})
+	if !ok || zoneResources["com.cloudflare.api.account.zone.*"] != "*" {
+		t.Errorf("expected zone policy nested under acct-123, got %v", policies[1].Resources)
+	}
+}
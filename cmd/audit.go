@@ -0,0 +1,674 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/99designs/keyring"
+	"github.com/olekukonko/tablewriter"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+const (
+	auditEventAdd        = "add"
+	auditEventExec       = "exec"
+	auditEventTokenMint  = "token_mint"
+	auditEventBreakGlass = "break_glass"
+
+	auditRedacted = "[REDACTED]"
+)
+
+// sensitiveFlags are cf-vault flags whose values are redacted from the
+// command line recorded in the audit log.
+var sensitiveFlags = []string{"--totp-code"}
+
+// auditHMACKeyringKey is the keyring item holding the audit log HMAC key.
+const auditHMACKeyringKey = "audit-hmac"
+
+// auditLockTimeout is how long to wait for another cf-vault process to finish
+// writing to the audit log, after which its lock is considered stale.
+const auditLockTimeout = 5 * time.Second
+
+var (
+	// auditMu serialises writes from the token refresher and the main
+	// goroutine.
+	auditMu sync.Mutex
+	// auditKey is the HMAC key for new audit records, set by useAuditKey when
+	// audit_hmac is enabled.
+	auditKey []byte
+	// auditHMACRequired is set when audit_hmac is enabled. Records aren't
+	// written until auditKey is loaded as an unsigned record would break the
+	// signed chain.
+	auditHMACRequired bool
+)
+
+// auditRecord is a single line of the JSON-lines audit log.
+type auditRecord struct {
+	Timestamp      time.Time  `json:"timestamp" yaml:"timestamp"`
+	Event          string     `json:"event" yaml:"event"`
+	User           string     `json:"user" yaml:"user"`
+	Hostname       string     `json:"hostname,omitempty" yaml:"hostname,omitempty"`
+	Profile        string     `json:"profile" yaml:"profile"`
+	Command        []string   `json:"command,omitempty" yaml:"command,omitempty"`
+	TokenID        string     `json:"token_id,omitempty" yaml:"token_id,omitempty"`
+	TokenExpiresOn *time.Time `json:"token_expires_on,omitempty" yaml:"token_expires_on,omitempty"`
+	StartedAt      *time.Time `json:"started_at,omitempty" yaml:"started_at,omitempty"`
+	ExitCode       *int       `json:"exit_code,omitempty" yaml:"exit_code,omitempty"`
+	BreakGlass     bool       `json:"break_glass,omitempty" yaml:"break_glass,omitempty"`
+	Reason         string     `json:"reason,omitempty" yaml:"reason,omitempty"`
+	// Error is why an exec session was refused or failed before the command
+	// started.
+	Error string `json:"error,omitempty" yaml:"error,omitempty"`
+	// PrevHash is the SHA-256 of the previous line of the log, chaining the
+	// records together so edits, reordering and removals can be detected.
+	PrevHash string `json:"prev_hash,omitempty" yaml:"prev_hash,omitempty"`
+	// HMAC authenticates the record, with this field empty, using the key in
+	// the keyring when audit_hmac is enabled.
+	HMAC string `json:"hmac,omitempty" yaml:"hmac,omitempty"`
+}
+
+// auditHead is stored next to the audit log and records the number of
+// records and the hash of the last one so truncation can be detected.
+type auditHead struct {
+	Count int    `json:"count"`
+	Hash  string `json:"hash"`
+	HMAC  string `json:"hmac,omitempty"`
+}
+
+var auditCmd = &cobra.Command{
+	Use:   "audit",
+	Short: "Show the audit log of credential use",
+	Long:  "",
+	Example: `
+  Show who used the production profile in the last week
+
+    $ cf-vault audit --profile production --since 168h
+
+  Print the matching records as JSON
+
+    $ cf-vault audit --event token_mint --output json
+`,
+	PreRun: func(cmd *cobra.Command, args []string) {
+		if verbose {
+			log.SetLevel(log.DebugLevel)
+		}
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		filter := auditFilter{}
+		filter.Profile, _ = cmd.Flags().GetString("profile")
+		filter.User, _ = cmd.Flags().GetString("user")
+		filter.Event, _ = cmd.Flags().GetString("event")
+		since, _ := cmd.Flags().GetDuration("since")
+
+		format, err := resolveOutputFormat()
+		if err != nil {
+			return err
+		}
+
+		if since > 0 {
+			filter.Since = time.Now().Add(-since)
+		}
+
+		configDir, err := resolveConfigDir()
+		if err != nil {
+			return err
+		}
+
+		if err := verifyPermissions(configDir); err != nil {
+			return err
+		}
+
+		path, err := resolveAuditLogPath()
+		if err != nil {
+			return err
+		}
+
+		records, err := readAuditLog(path)
+		if err != nil {
+			return err
+		}
+
+		matched := []auditRecord{}
+		for _, r := range records {
+			if filter.matches(r) {
+				matched = append(matched, r)
+			}
+		}
+
+		if format != outputTable {
+			return writeStructured(os.Stdout, format, matched)
+		}
+
+		if len(matched) == 0 {
+			fmt.Printf("no audit records found at %s\n", path)
+			return nil
+		}
+
+		tableData := [][]string{}
+		for _, r := range matched {
+			var exitCode string
+			if r.ExitCode != nil {
+				exitCode = strconv.Itoa(*r.ExitCode)
+			}
+			tableData = append(tableData, []string{
+				r.Timestamp.Local().Format(time.RFC3339),
+				r.User,
+				r.Event,
+				r.Profile,
+				r.TokenID,
+				exitCode,
+				r.Error,
+				strings.Join(r.Command, " "),
+			})
+		}
+
+		table := tablewriter.NewWriter(os.Stdout)
+		table.SetHeader([]string{"Timestamp", "User", "Event", "Profile", "Token ID", "Exit code", "Error", "Command"})
+		table.SetAutoWrapText(false)
+		table.SetAutoFormatHeaders(true)
+		table.SetHeaderAlignment(tablewriter.ALIGN_LEFT)
+		table.SetAlignment(tablewriter.ALIGN_LEFT)
+		table.SetCenterSeparator("")
+		table.SetColumnSeparator("")
+		table.SetRowSeparator("")
+		table.SetHeaderLine(false)
+		table.SetBorder(false)
+		table.SetTablePadding("\t")
+		table.SetNoWhiteSpace(true)
+		table.AppendBulk(tableData)
+		table.Render()
+
+		return nil
+	},
+}
+
+// auditVerification is the result of `audit verify`.
+type auditVerification struct {
+	Path     string   `json:"path" yaml:"path"`
+	Records  int      `json:"records" yaml:"records"`
+	HMAC     bool     `json:"hmac" yaml:"hmac"`
+	Intact   bool     `json:"intact" yaml:"intact"`
+	Problems []string `json:"problems,omitempty" yaml:"problems,omitempty"`
+}
+
+var auditVerifyCmd = &cobra.Command{
+	Use:   "verify",
+	Short: "Check the audit log hasn't been edited, reordered or truncated",
+	Long:  "",
+	Example: `
+  Verify the hash chain, and HMACs when audit_hmac is enabled
+
+    $ cf-vault audit verify
+`,
+	PreRun: func(cmd *cobra.Command, args []string) {
+		if verbose {
+			log.SetLevel(log.DebugLevel)
+			keyring.Debug = true
+		}
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		format, err := resolveOutputFormat()
+		if err != nil {
+			return err
+		}
+
+		path, err := resolveAuditLogPath()
+		if err != nil {
+			return err
+		}
+
+		configDir, err := resolveConfigDir()
+		if err != nil {
+			return err
+		}
+
+		if err := verifyPermissions(configDir); err != nil {
+			return err
+		}
+
+		var key []byte
+		config, err := readConfig(filepath.Join(configDir, "config.toml"))
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		if config.AuditHMAC {
+			ring, err := openKeyring()
+			if err != nil {
+				return &keyringUnavailableError{err: fmt.Errorf("failed to open keyring backend: %s", strings.ToLower(err.Error()))}
+			}
+			item, err := ring.Get(auditHMACKeyringKey)
+			if err != nil {
+				return &keyringUnavailableError{err: fmt.Errorf("failed to get audit HMAC key from keyring: %s", strings.ToLower(err.Error()))}
+			}
+			key = item.Data
+		}
+
+		problems, count, err := verifyAuditLog(path, key)
+		if err != nil {
+			return err
+		}
+
+		result := auditVerification{
+			Path:     path,
+			Records:  count,
+			HMAC:     key != nil,
+			Intact:   len(problems) == 0,
+			Problems: problems,
+		}
+
+		switch {
+		case format != outputTable:
+			if err := writeStructured(os.Stdout, format, result); err != nil {
+				return err
+			}
+		case !result.Intact:
+			for _, p := range problems {
+				fmt.Println(p)
+			}
+		case result.HMAC:
+			fmt.Printf("%s: %d records, hash chain and HMACs intact\n", path, count)
+		default:
+			fmt.Printf("%s: %d records, hash chain intact\n", path, count)
+		}
+
+		if !result.Intact {
+			return &exitStatusError{code: exitError}
+		}
+		return nil
+	},
+}
+
+// currentUsername returns the OS user running cf-vault.
+func currentUsername() string {
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+	if name := os.Getenv("USER"); name != "" {
+		return name
+	}
+	return os.Getenv("USERNAME")
+}
+
+// redactCommandLine returns a copy of args with every occurrence of the
+// secrets, and the values of sensitiveFlags, replaced by auditRedacted.
+func redactCommandLine(args []string, secrets []string) []string {
+	out := make([]string, len(args))
+	redactNext := false
+	for i, arg := range args {
+		if redactNext {
+			out[i] = auditRedacted
+			redactNext = false
+			continue
+		}
+
+		for _, s := range secrets {
+			if s != "" {
+				arg = strings.ReplaceAll(arg, s, auditRedacted)
+			}
+		}
+
+		for _, flag := range sensitiveFlags {
+			if arg == flag {
+				redactNext = true
+			} else if strings.HasPrefix(arg, flag+"=") {
+				arg = flag + "=" + auditRedacted
+			}
+		}
+
+		out[i] = arg
+	}
+	return out
+}
+
+// appendAuditRecord completes the record with the time, user and host and
+// appends it to the audit log. Failing to write the log doesn't stop
+// cf-vault but is reported.
+func appendAuditRecord(r auditRecord) {
+	if auditHMACRequired && auditKey == nil {
+		log.Warnf("not writing the %s audit record, audit_hmac is enabled but its key isn't loaded from the keyring", r.Event)
+		return
+	}
+
+	if r.Timestamp.IsZero() {
+		r.Timestamp = time.Now().UTC()
+	}
+	if r.User == "" {
+		r.User = currentUsername()
+	}
+	if r.Hostname == "" {
+		r.Hostname, _ = os.Hostname()
+	}
+
+	path, err := resolveAuditLogPath()
+	if err == nil {
+		err = writeAuditRecord(path, r, auditKey)
+	}
+	if err != nil {
+		log.Warnf("failed to write audit log: %s", err)
+	}
+}
+
+// writeAuditRecord chains r to the last record, authenticates it with key
+// when one is given and appends it to the audit log at path, creating it if
+// needed. The head file is updated to match.
+func writeAuditRecord(path string, r auditRecord, key []byte) error {
+	auditMu.Lock()
+	defer auditMu.Unlock()
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+
+	unlock, err := lockAuditLog(path)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	head, err := currentAuditHead(path)
+	if err != nil {
+		return err
+	}
+
+	r.PrevHash = head.Hash
+	r.HMAC = ""
+	if key != nil {
+		unsigned, err := json.Marshal(r)
+		if err != nil {
+			return err
+		}
+		r.HMAC = auditMAC(key, unsigned)
+	}
+
+	line, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return writeAuditHead(path, auditHead{Count: head.Count + 1, Hash: auditHash(line)}, key)
+}
+
+// auditHash returns the hex encoded SHA-256 of a line of the audit log.
+func auditHash(line []byte) string {
+	sum := sha256.Sum256(line)
+	return hex.EncodeToString(sum[:])
+}
+
+// auditMAC returns the hex encoded HMAC-SHA256 of data.
+func auditMAC(key, data []byte) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(data)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// auditHeadPath is the file the head of the audit log at path is kept in.
+func auditHeadPath(path string) string {
+	return path + ".head"
+}
+
+// currentAuditHead returns the head of the audit log. Should the head file be
+// missing, for logs written before it existed, it is rebuilt from the log.
+func currentAuditHead(path string) (auditHead, error) {
+	data, err := os.ReadFile(auditHeadPath(path))
+	if err == nil {
+		var head auditHead
+		if err := json.Unmarshal(data, &head); err != nil {
+			return auditHead{}, fmt.Errorf("failed to parse %s: %w", auditHeadPath(path), err)
+		}
+		return head, nil
+	}
+	if !os.IsNotExist(err) {
+		return auditHead{}, err
+	}
+
+	lines, err := readAuditLines(path)
+	if err != nil {
+		return auditHead{}, err
+	}
+	if len(lines) == 0 {
+		return auditHead{}, nil
+	}
+	return auditHead{Count: len(lines), Hash: auditHash(lines[len(lines)-1])}, nil
+}
+
+// writeAuditHead atomically replaces the head file, authenticating it with
+// key when one is given.
+func writeAuditHead(path string, head auditHead, key []byte) error {
+	head.HMAC = ""
+	if key != nil {
+		head.HMAC = auditMAC(key, []byte(fmt.Sprintf("%d:%s", head.Count, head.Hash)))
+	}
+
+	data, err := json.Marshal(head)
+	if err != nil {
+		return err
+	}
+	return writeSecretFile(auditHeadPath(path), string(data)+"\n")
+}
+
+// lockAuditLog stops other cf-vault processes writing to the audit log until
+// the returned function is called, so the chain doesn't fork.
+func lockAuditLog(path string) (func(), error) {
+	lockPath := path + ".lock"
+	deadline := time.Now().Add(auditLockTimeout)
+
+	for {
+		f, err := os.OpenFile(lockPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if err == nil {
+			f.Close()
+			return func() { os.Remove(lockPath) }, nil
+		}
+		if !os.IsExist(err) {
+			return nil, err
+		}
+
+		if time.Now().After(deadline) {
+			// The process holding the lock most likely died mid-write.
+			if info, err := os.Stat(lockPath); err == nil && time.Since(info.ModTime()) > auditLockTimeout {
+				log.Debugf("removing stale audit log lock %s", lockPath)
+				os.Remove(lockPath)
+				deadline = time.Now().Add(auditLockTimeout)
+				continue
+			}
+			return nil, fmt.Errorf("timed out waiting for the audit log lock at %s", lockPath)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// useAuditKey loads the audit log HMAC key from the keyring, creating it the
+// first time, and uses it for every record written afterwards.
+func useAuditKey(ring keyring.Keyring) error {
+	item, err := ring.Get(auditHMACKeyringKey)
+	if err == keyring.ErrKeyNotFound {
+		key := make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return err
+		}
+		item = keyring.Item{Key: auditHMACKeyringKey, Data: []byte(hex.EncodeToString(key))}
+		if err := ring.Set(item); err != nil {
+			return err
+		}
+	} else if err != nil {
+		return err
+	}
+
+	auditKey = item.Data
+	return nil
+}
+
+// readAuditLines returns every non-empty line of the audit log at path. A
+// missing log has no lines.
+func readAuditLines(path string) ([][]byte, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var lines [][]byte
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		lines = append(lines, append([]byte{}, scanner.Bytes()...))
+	}
+	return lines, scanner.Err()
+}
+
+// readAuditLog returns every record in the audit log at path. A missing log
+// has no records.
+func readAuditLog(path string) ([]auditRecord, error) {
+	lines, err := readAuditLines(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var records []auditRecord
+	for i, line := range lines {
+		var r auditRecord
+		if err := json.Unmarshal(line, &r); err != nil {
+			return nil, fmt.Errorf("failed to parse record %d of %s: %w", i+1, path, err)
+		}
+		records = append(records, r)
+	}
+	return records, nil
+}
+
+// verifyAuditLog checks the chain of records in the audit log at path against
+// its head file, and their HMACs when key is given, returning every problem
+// found.
+func verifyAuditLog(path string, key []byte) ([]string, int, error) {
+	lines, err := readAuditLines(path)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var problems []string
+	prevHash := ""
+	signed := false
+	for i, line := range lines {
+		n := i + 1
+
+		var r auditRecord
+		if err := json.Unmarshal(line, &r); err != nil {
+			problems = append(problems, fmt.Sprintf("record %d: not valid JSON: %s", n, err))
+			prevHash = auditHash(line)
+			continue
+		}
+
+		if r.PrevHash != prevHash {
+			problems = append(problems, fmt.Sprintf("record %d: chain broken, the previous record was edited, removed or reordered", n))
+		}
+		prevHash = auditHash(line)
+
+		switch {
+		case r.HMAC != "":
+			signed = true
+			if key == nil {
+				problems = append(problems, fmt.Sprintf("record %d: has an HMAC but audit_hmac isn't enabled to verify it", n))
+				continue
+			}
+			mac := r.HMAC
+			r.HMAC = ""
+			unsigned, err := json.Marshal(r)
+			if err != nil {
+				return nil, 0, err
+			}
+			if !hmac.Equal([]byte(auditMAC(key, unsigned)), []byte(mac)) {
+				problems = append(problems, fmt.Sprintf("record %d: HMAC mismatch, the record was edited", n))
+			}
+		case signed:
+			problems = append(problems, fmt.Sprintf("record %d: missing HMAC after signed records", n))
+		}
+	}
+
+	data, err := os.ReadFile(auditHeadPath(path))
+	if os.IsNotExist(err) {
+		if len(lines) > 0 {
+			problems = append(problems, fmt.Sprintf("head file %s is missing", auditHeadPath(path)))
+		}
+		return problems, len(lines), nil
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var head auditHead
+	if err := json.Unmarshal(data, &head); err != nil {
+		problems = append(problems, fmt.Sprintf("head file is not valid JSON: %s", err))
+		return problems, len(lines), nil
+	}
+	if head.Count != len(lines) || head.Hash != prevHash {
+		problems = append(problems, fmt.Sprintf("head records %d entries but the log has %d or its last record differs, the log was truncated or appended to", head.Count, len(lines)))
+	}
+	// The head must always be signed when audit_hmac is enabled, otherwise the
+	// whole log could be rewritten without HMACs and the chain rebuilt.
+	switch {
+	case key == nil:
+	case head.HMAC == "":
+		problems = append(problems, "head file has no HMAC but audit_hmac is enabled, the log was rewritten without HMACs")
+	case !hmac.Equal([]byte(auditMAC(key, []byte(fmt.Sprintf("%d:%s", head.Count, head.Hash)))), []byte(head.HMAC)):
+		problems = append(problems, "head file HMAC mismatch, the head was edited")
+	}
+
+	return problems, len(lines), nil
+}
+
+// auditFilter selects audit records, empty fields match everything.
+type auditFilter struct {
+	Profile string
+	User    string
+	Event   string
+	Since   time.Time
+}
+
+// matches reports whether r is selected by the filter.
+func (f auditFilter) matches(r auditRecord) bool {
+	if f.Profile != "" && r.Profile != f.Profile {
+		return false
+	}
+	if f.User != "" && r.User != f.User {
+		return false
+	}
+	if f.Event != "" && r.Event != f.Event {
+		return false
+	}
+	if !f.Since.IsZero() && r.Timestamp.Before(f.Since) {
+		return false
+	}
+	return true
+}
@@ -0,0 +1,237 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRedactCommandLine(t *testing.T) {
+	args := []string{"cf-vault", "exec", "--totp-code", "123456", "production", "--", "curl", "-H", "Authorization: Bearer s3cr3t", "--totp-code=654321"}
+
+	want := []string{"cf-vault", "exec", "--totp-code", auditRedacted, "production", "--", "curl", "-H", "Authorization: Bearer " + auditRedacted, "--totp-code=" + auditRedacted}
+	if got := redactCommandLine(args, []string{"s3cr3t", ""}); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
+
+func TestWriteAndReadAuditLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "nested", "audit.log")
+	expiry := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	exitCode := 0
+
+	records := []auditRecord{
+		{Timestamp: expiry.Add(-time.Hour), Event: auditEventTokenMint, User: "alice", Profile: "production", TokenID: "abc", TokenExpiresOn: &expiry},
+		{Timestamp: expiry.Add(-time.Minute), Event: auditEventExec, User: "alice", Profile: "production", ExitCode: &exitCode},
+	}
+	for _, r := range records {
+		if err := writeAuditRecord(path, r, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := readAuditLog(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[0].PrevHash != "" || got[1].PrevHash == "" {
+		t.Fatalf("expected the second record to be chained to the first, got %+v", got)
+	}
+	records[1].PrevHash = got[1].PrevHash
+	if !reflect.DeepEqual(got, records) {
+		t.Errorf("expected %+v, got %+v", records, got)
+	}
+
+	missing, err := readAuditLog(filepath.Join(t.TempDir(), "missing.log"))
+	if err != nil || missing != nil {
+		t.Errorf("expected a missing log to have no records, got %v, %v", missing, err)
+	}
+}
+
+func TestAuditFilter(t *testing.T) {
+	now := time.Now()
+	r := auditRecord{Timestamp: now, Event: auditEventExec, User: "alice", Profile: "production"}
+
+	tests := []struct {
+		name   string
+		filter auditFilter
+		want   bool
+	}{
+		{"empty", auditFilter{}, true},
+		{"profile", auditFilter{Profile: "production"}, true},
+		{"other profile", auditFilter{Profile: "staging"}, false},
+		{"other user", auditFilter{User: "bob"}, false},
+		{"other event", auditFilter{Event: auditEventAdd}, false},
+		{"since before", auditFilter{Since: now.Add(-time.Minute)}, true},
+		{"since after", auditFilter{Since: now.Add(time.Minute)}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.filter.matches(r); got != tt.want {
+				t.Errorf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+// writeTestAuditLog writes n records to a new audit log and returns its path.
+func writeTestAuditLog(t *testing.T, n int, key []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "audit.log")
+	for i := 0; i < n; i++ {
+		r := auditRecord{Timestamp: time.Unix(int64(1700000000+i), 0).UTC(), Event: auditEventExec, User: "alice", Profile: fmt.Sprintf("profile-%d", i)}
+		if err := writeAuditRecord(path, r, key); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return path
+}
+
+// rewriteAuditLines replaces the audit log at path with the output of edit.
+func rewriteAuditLines(t *testing.T, path string, edit func([][]byte) [][]byte) {
+	t.Helper()
+	lines, err := readAuditLines(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, append(bytes.Join(edit(lines), []byte("\n")), '\n'), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestVerifyAuditLog(t *testing.T) {
+	key := []byte("test-key")
+
+	tests := []struct {
+		name    string
+		key     []byte
+		verify  []byte
+		tamper  func(t *testing.T, path string)
+		problem string
+	}{
+		{name: "intact"},
+		{name: "intact with hmac", key: key, verify: key},
+		{name: "edited", tamper: func(t *testing.T, path string) {
+			rewriteAuditLines(t, path, func(lines [][]byte) [][]byte {
+				lines[1] = bytes.Replace(lines[1], []byte("profile-1"), []byte("profile-x"), 1)
+				return lines
+			})
+		}, problem: "record 3: chain broken"},
+		{name: "reordered", tamper: func(t *testing.T, path string) {
+			rewriteAuditLines(t, path, func(lines [][]byte) [][]byte {
+				lines[0], lines[1] = lines[1], lines[0]
+				return lines
+			})
+		}, problem: "record 1: chain broken"},
+		{name: "truncated", tamper: func(t *testing.T, path string) {
+			rewriteAuditLines(t, path, func(lines [][]byte) [][]byte { return lines[:2] })
+		}, problem: "the log was truncated"},
+		{name: "head removed", tamper: func(t *testing.T, path string) {
+			os.Remove(auditHeadPath(path))
+		}, problem: "is missing"},
+		{name: "last record edited", key: key, verify: key, tamper: func(t *testing.T, path string) {
+			rewriteAuditLines(t, path, func(lines [][]byte) [][]byte {
+				lines[2] = bytes.Replace(lines[2], []byte("alice"), []byte("mallory"), 1)
+				return lines
+			})
+		}, problem: "record 3: HMAC mismatch"},
+		{name: "hmacs stripped and chain rebuilt", key: key, verify: key, tamper: stripAuditHMACs, problem: "head file has no HMAC"},
+		{name: "wrong key", key: key, verify: []byte("other-key"), problem: "HMAC mismatch"},
+		{name: "hmac without key", key: key, problem: "audit_hmac isn't enabled"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeTestAuditLog(t, 3, tt.key)
+			if tt.tamper != nil {
+				tt.tamper(t, path)
+			}
+
+			problems, count, err := verifyAuditLog(path, tt.verify)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if count != len(mustReadAuditLines(t, path)) {
+				t.Errorf("unexpected record count %d", count)
+			}
+
+			if tt.problem == "" {
+				if len(problems) > 0 {
+					t.Errorf("expected no problems, got %v", problems)
+				}
+				return
+			}
+			found := false
+			for _, p := range problems {
+				if strings.Contains(p, tt.problem) {
+					found = true
+				}
+			}
+			if !found {
+				t.Errorf("expected a problem containing %q, got %v", tt.problem, problems)
+			}
+		})
+	}
+}
+
+// stripAuditHMACs rewrites the audit log at path without HMACs, rebuilding
+// the hash chain and an unsigned head as someone without the key could.
+func stripAuditHMACs(t *testing.T, path string) {
+	t.Helper()
+	prevHash := ""
+	rewriteAuditLines(t, path, func(lines [][]byte) [][]byte {
+		for i, line := range lines {
+			var r auditRecord
+			if err := json.Unmarshal(line, &r); err != nil {
+				t.Fatal(err)
+			}
+			r.HMAC = ""
+			r.PrevHash = prevHash
+			rewritten, err := json.Marshal(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			lines[i] = rewritten
+			prevHash = auditHash(rewritten)
+		}
+		return lines
+	})
+
+	lines := mustReadAuditLines(t, path)
+	if err := writeAuditHead(path, auditHead{Count: len(lines), Hash: prevHash}, nil); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func mustReadAuditLines(t *testing.T, path string) [][]byte {
+	t.Helper()
+	lines, err := readAuditLines(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return lines
+}
+
+func TestCurrentAuditHeadRebuildsMissingHead(t *testing.T) {
+	path := writeTestAuditLog(t, 2, nil)
+	want, err := currentAuditHead(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	os.Remove(auditHeadPath(path))
+	got, err := currentAuditHead(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != want {
+		t.Errorf("expected rebuilt head %+v, got %+v", want, got)
+	}
+}
@@ -0,0 +1,163 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+
+	"github.com/pelletier/go-toml"
+)
+
+// readConfig reads and parses the TOML configuration file at configPath.
+// Failures are returned as a configInvalidError.
+func readConfig(configPath string) (tomlConfig, error) {
+	config := tomlConfig{}
+
+	configData, err := os.ReadFile(configPath)
+	if err != nil {
+		return config, &configInvalidError{err: err}
+	}
+
+	if err := toml.Unmarshal(configData, &config); err != nil {
+		return config, &configInvalidError{err: fmt.Errorf("failed to parse %s: %w", configPath, err)}
+	}
+
+	return config, nil
+}
+
+// validate checks the settings which apply to every profile. Profiles are
+// validated separately so a single broken profile doesn't block the others.
+func (c tomlConfig) validate() error {
+	if c.MaxSessionDuration != "" {
+		if _, err := parseSessionDuration("max_session_duration", c.MaxSessionDuration); err != nil {
+			return err
+		}
+	}
+	if err := validateTokenNameTemplate(c.TokenNameTemplate); err != nil {
+		return err
+	}
+	return validateNestedSessions(c.NestedSessions)
+}
+
+// validate checks the profile for values that would otherwise only fail once
+// `exec` tries to use them. Problems with the policies are returned as a
+// policyInvalidError.
+func (p profile) validate() error {
+	switch p.AuthType {
+	case "api_token":
+	case "api_key":
+		if p.Email == "" {
+			return fmt.Errorf("auth_type %q requires an email", p.AuthType)
+		}
+	case "access_service_token", "origin_ca_key":
+		if p.SessionDuration != "" {
+			return fmt.Errorf("auth_type %q cannot be used to create short lived tokens, remove session_duration", p.AuthType)
+		}
+	case "":
+		return fmt.Errorf("auth_type is not set")
+	default:
+		return fmt.Errorf("unknown auth_type %q", p.AuthType)
+	}
+
+	if p.MaxSessionDuration != "" {
+		if _, err := parseSessionDuration("max_session_duration", p.MaxSessionDuration); err != nil {
+			return err
+		}
+	}
+
+	// The global max_session_duration is checked by validateSessionDuration
+	// once the whole configuration is known.
+	if err := validateSessionDuration(tomlConfig{}, p); err != nil {
+		return err
+	}
+
+	if p.SessionDuration != "" {
+		if len(p.Policies) == 0 {
+			return &policyInvalidError{err: errors.New("session_duration is set but no policies are defined for the short lived token")}
+		}
+	}
+
+	if p.AccountID != "" && p.AccountName != "" {
+		return fmt.Errorf("only one of account_id and account_name can be set")
+	}
+	if p.ZoneID != "" && p.ZoneName != "" {
+		return fmt.Errorf("only one of zone_id and zone_name can be set")
+	}
+	if (p.AccountName != "" || p.ZoneName != "") && p.AuthType != "api_token" && p.AuthType != "api_key" {
+		return fmt.Errorf("account_name and zone_name can only be resolved using an API token or API key")
+	}
+
+	if (len(p.AllowedIPs) > 0 || len(p.DeniedIPs) > 0) && p.SessionDuration == "" {
+		return fmt.Errorf("allowed_ips and denied_ips only apply to short lived tokens, set session_duration")
+	}
+	for _, cidr := range append(append([]string{}, p.AllowedIPs...), p.DeniedIPs...) {
+		if _, _, err := net.ParseCIDR(cidr); err != nil {
+			return fmt.Errorf("invalid CIDR %q in allowed_ips or denied_ips", cidr)
+		}
+	}
+
+	switch p.TokenOwner {
+	case "", "user":
+	case "account":
+		if p.AccountID == "" {
+			return fmt.Errorf("token_owner \"account\" requires account_id to be set")
+		}
+	default:
+		return fmt.Errorf("token_owner must be \"user\" or \"account\", got %q", p.TokenOwner)
+	}
+
+	if err := validateTokenNameTemplate(p.TokenNameTemplate); err != nil {
+		return err
+	}
+
+	if p.ConfirmationMessage != "" && !p.RequireConfirmation {
+		return fmt.Errorf("confirmation_message is set but require_confirmation is not enabled")
+	}
+
+	if err := validateNestedSessions(p.NestedSessions); err != nil {
+		return err
+	}
+
+	if err := p.Env.validate(); err != nil {
+		return err
+	}
+
+	if err := p.Hooks.validate(); err != nil {
+		return err
+	}
+
+	if err := p.AllowedWindow.validate(); err != nil {
+		return err
+	}
+
+	for i, pol := range p.Policies {
+		if pol.Effect != "allow" && pol.Effect != "deny" {
+			return &policyInvalidError{err: fmt.Errorf("policy %d: effect must be \"allow\" or \"deny\", got %q", i, pol.Effect)}
+		}
+		if len(pol.PermissionGroups) == 0 {
+			return &policyInvalidError{err: fmt.Errorf("policy %d: no permission groups defined", i)}
+		}
+		for _, g := range pol.PermissionGroups {
+			if g.ID == "" {
+				return &policyInvalidError{err: fmt.Errorf("policy %d: permission group %q is missing an id", i, g.Name)}
+			}
+		}
+		if len(pol.Resources) == 0 {
+			return &policyInvalidError{err: fmt.Errorf("policy %d: no resources defined", i)}
+		}
+		// The API takes either flat or nested resources, a mix of both can't
+		// be sent without dropping some of them.
+		nested := 0
+		for _, v := range pol.Resources {
+			if _, ok := v.(map[string]interface{}); ok {
+				nested++
+			}
+		}
+		if nested > 0 && nested < len(pol.Resources) {
+			return &policyInvalidError{err: fmt.Errorf("policy %d: resources must either all be strings or all be tables, not a mix of both", i)}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,147 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func validPolicies() []policy {
+	return []policy{
+		{
+			Effect:           "allow",
+			PermissionGroups: []permissionGroup{{ID: "abc", Name: "DNS Read"}},
+			Resources:        map[string]interface{}{"com.cloudflare.api.account.*": "*"},
+		},
+	}
+}
+
+func TestProfileValidate_Valid(t *testing.T) {
+	profiles := []profile{
+		{AuthType: "api_token"},
+		{AuthType: "api_key", Email: "user@example.com"},
+		{AuthType: "api_token", SessionDuration: "15m", Policies: validPolicies()},
+		{AuthType: "access_service_token"},
+		{AuthType: "origin_ca_key"},
+		{AuthType: "api_token", TokenOwner: "account", AccountID: "abc"},
+		{AuthType: "api_token", SessionDuration: "15m", Policies: validPolicies(), AllowedIPs: []string{"192.0.2.0/24", "2001:db8::/32"}, DeniedIPs: []string{"192.0.2.1/32"}},
+	}
+	for _, p := range profiles {
+		if err := p.validate(); err != nil {
+			t.Errorf("expected %+v to be valid, got: %v", p, err)
+		}
+	}
+}
+
+func TestProfileValidate_Invalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		profile profile
+		want    string
+	}{
+		{"missing auth type", profile{}, "auth_type is not set"},
+		{"unknown auth type", profile{AuthType: "password"}, "unknown auth_type"},
+		{"api key without email", profile{AuthType: "api_key"}, "requires an email"},
+		{"origin ca key with session", profile{AuthType: "origin_ca_key", SessionDuration: "15m", Policies: validPolicies()}, "cannot be used to create short lived tokens"},
+		{"access service token with session", profile{AuthType: "access_service_token", SessionDuration: "15m", Policies: validPolicies()}, "cannot be used to create short lived tokens"},
+		{"account owner without account", profile{AuthType: "api_token", TokenOwner: "account"}, "requires account_id"},
+		{"unknown token owner", profile{AuthType: "api_token", TokenOwner: "team"}, "token_owner must be"},
+		{"account id and name", profile{AuthType: "api_token", AccountID: "abc", AccountName: "Example"}, "only one of account_id and account_name"},
+		{"zone id and name", profile{AuthType: "api_token", ZoneID: "abc", ZoneName: "example.com"}, "only one of zone_id and zone_name"},
+		{"zone name with origin ca key", profile{AuthType: "origin_ca_key", ZoneName: "example.com"}, "can only be resolved"},
+		{"bad duration", profile{AuthType: "api_token", SessionDuration: "15 minutes", Policies: validPolicies()}, "invalid session_duration"},
+		{"negative duration", profile{AuthType: "api_token", SessionDuration: "-15m", Policies: validPolicies()}, "must be positive"},
+		{"duration too short", profile{AuthType: "api_token", SessionDuration: "10s", Policies: validPolicies()}, "too short"},
+		{"duration beyond profile maximum", profile{AuthType: "api_token", SessionDuration: "15h", MaxSessionDuration: "1h", Policies: validPolicies()}, "longer than the max_session_duration"},
+		{"invalid maximum", profile{AuthType: "api_token", MaxSessionDuration: "forever"}, "invalid max_session_duration"},
+		{"unknown token name placeholder", profile{AuthType: "api_token", TokenNameTemplate: "{profile}-{team}"}, "unknown placeholder"},
+		{"duration without policies", profile{AuthType: "api_token", SessionDuration: "15m"}, "no policies"},
+		{"allowed ips without session", profile{AuthType: "api_token", AllowedIPs: []string{"192.0.2.0/24"}}, "only apply to short lived tokens"},
+		{"invalid allowed ip", profile{AuthType: "api_token", SessionDuration: "15m", Policies: validPolicies(), AllowedIPs: []string{"192.0.2.1"}}, "invalid CIDR"},
+		{"invalid denied ip", profile{AuthType: "api_token", SessionDuration: "15m", Policies: validPolicies(), DeniedIPs: []string{"not-an-ip/8"}}, "invalid CIDR"},
+		{"confirmation message without confirmation", profile{AuthType: "api_token", ConfirmationMessage: "Careful"}, "require_confirmation is not enabled"},
+		{"unknown nested sessions policy", profile{AuthType: "api_token", NestedSessions: "sometimes"}, "nested_sessions must be"},
+		{"bad effect", profile{AuthType: "api_token", Policies: []policy{{Effect: "permit"}}}, "effect must be"},
+		{"no permission groups", profile{AuthType: "api_token", Policies: []policy{{Effect: "allow"}}}, "no permission groups"},
+		{"permission group without id", profile{AuthType: "api_token", Policies: []policy{{
+			Effect:           "allow",
+			PermissionGroups: []permissionGroup{{Name: "DNS Read"}},
+		}}}, "missing an id"},
+		{"no resources", profile{AuthType: "api_token", Policies: []policy{{
+			Effect:           "allow",
+			PermissionGroups: []permissionGroup{{ID: "abc"}},
+		}}}, "no resources"},
+		{"mixed flat and nested resources", profile{AuthType: "api_token", Policies: []policy{{
+			Effect:           "allow",
+			PermissionGroups: []permissionGroup{{ID: "abc"}},
+			Resources: map[string]interface{}{
+				"com.cloudflare.api.account.zone.*": "*",
+				"com.cloudflare.api.account.abc":    map[string]interface{}{"com.cloudflare.api.account.zone.*": "*"},
+			},
+		}}}, "not a mix of both"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.profile.validate()
+			if err == nil {
+				t.Fatal("expected error, got nil")
+			}
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("expected error containing %q, got: %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestConfigValidate_MaxSessionDuration(t *testing.T) {
+	if err := (tomlConfig{MaxSessionDuration: "12h"}).validate(); err != nil {
+		t.Errorf("expected 12h to be valid, got: %v", err)
+	}
+	err := (tomlConfig{MaxSessionDuration: "30s"}).validate()
+	if err == nil || !strings.Contains(err.Error(), "max_session_duration of 30s is too short") {
+		t.Errorf("expected max_session_duration error, got: %v", err)
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	if err := (tomlConfig{NestedSessions: "replace"}).validate(); err != nil {
+		t.Errorf("expected valid config, got %v", err)
+	}
+	if err := (tomlConfig{NestedSessions: "always"}).validate(); err == nil {
+		t.Error("expected an error for an unknown nested_sessions policy")
+	}
+}
+
+func TestReadConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.toml")
+	content := `
+[profiles]
+  [profiles.example]
+    email = "user@example.com"
+    auth_type = "api_key"
+`
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	config, err := readConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Profiles["example"].Email != "user@example.com" {
+		t.Errorf("expected email to be parsed, got %+v", config.Profiles)
+	}
+}
+
+func TestReadConfig_InvalidTOML(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.toml")
+	if err := os.WriteFile(path, []byte("[profiles\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := readConfig(path); err == nil {
+		t.Fatal("expected error for invalid TOML, got nil")
+	}
+}
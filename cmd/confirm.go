@@ -0,0 +1,24 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// confirmProfile asks the user to type the profile's name to confirm they
+// meant to use it.
+func confirmProfile(r io.Reader, w io.Writer, profileName, message string) error {
+	if message == "" {
+		message = fmt.Sprintf("Profile %q requires confirmation.", profileName)
+	}
+	fmt.Fprintln(w, message)
+	fmt.Fprint(w, "Type the profile name to continue: ")
+
+	answer, _ := bufio.NewReader(r).ReadString('\n')
+	if strings.TrimSpace(answer) != profileName {
+		return fmt.Errorf("confirmation for profile %q failed, the typed name didn't match", profileName)
+	}
+	return nil
+}
@@ -0,0 +1,29 @@
+package cmd
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestConfirmProfile(t *testing.T) {
+	var out bytes.Buffer
+	if err := confirmProfile(strings.NewReader("production\n"), &out, "production", ""); err != nil {
+		t.Errorf("expected confirmation to succeed, got %v", err)
+	}
+	if !strings.Contains(out.String(), `Profile "production" requires confirmation.`) {
+		t.Errorf("expected the default message, got %q", out.String())
+	}
+
+	out.Reset()
+	if err := confirmProfile(strings.NewReader("prod\n"), &out, "production", "This deletes things."); err == nil {
+		t.Error("expected a mismatched name to fail")
+	}
+	if !strings.Contains(out.String(), "This deletes things.") {
+		t.Errorf("expected the custom message, got %q", out.String())
+	}
+
+	if err := confirmProfile(strings.NewReader(""), &out, "production", ""); err == nil {
+		t.Error("expected no answer to fail")
+	}
+}
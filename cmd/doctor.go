@@ -0,0 +1,285 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+
+	"github.com/99designs/keyring"
+	"github.com/mitchellh/go-homedir"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+const (
+	checkOK   = "ok"
+	checkWarn = "warn"
+	checkFail = "fail"
+)
+
+// doctorCheck is the outcome of a single diagnostic performed by `doctor`.
+type doctorCheck struct {
+	Name    string `json:"name" yaml:"name"`
+	Status  string `json:"status" yaml:"status"`
+	Message string `json:"message" yaml:"message"`
+}
+
+var doctorCmd = &cobra.Command{
+	Use:   "doctor",
+	Short: "Diagnose common configuration and environment problems",
+	Long:  "",
+	Example: `
+  Print a checklist of the current environment
+
+    $ cf-vault doctor
+
+  Print the same diagnostics as JSON
+
+    $ cf-vault doctor --output json
+
+  Remove group and world access from the config and keyring files
+
+    $ cf-vault doctor --fix
+`,
+	PreRun: func(cmd *cobra.Command, args []string) {
+		if verbose {
+			log.SetLevel(log.DebugLevel)
+			keyring.Debug = true
+		}
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		fix, _ := cmd.Flags().GetBool("fix")
+
+		format, err := resolveOutputFormat()
+		if err != nil {
+			return err
+		}
+
+		if fix {
+			configDir, err := resolveConfigDir()
+			if err != nil {
+				return err
+			}
+
+			fixed, err := fixPermissions(configDir)
+			if err != nil {
+				return err
+			}
+			for _, p := range fixed {
+				fmt.Fprintf(os.Stderr, "fixed permissions on %s\n", p)
+			}
+		}
+
+		checks := runDoctorChecks()
+
+		if format == outputTable {
+			for _, c := range checks {
+				fmt.Printf("[%s] %s: %s\n", c.Status, c.Name, c.Message)
+			}
+		} else if err := writeStructured(os.Stdout, format, checks); err != nil {
+			return err
+		}
+
+		for _, c := range checks {
+			if c.Status == checkFail {
+				return &exitStatusError{code: exitError}
+			}
+		}
+
+		return nil
+	},
+}
+
+// runDoctorChecks performs every diagnostic in the order they are displayed.
+func runDoctorChecks() []doctorCheck {
+	var checks []doctorCheck
+
+	checks = append(checks, checkDirectories()...)
+	checks = append(checks, checkKeyringBackends()...)
+	checks = append(checks, checkConfig()...)
+	checks = append(checks, checkNestedSession(), checkShell())
+
+	return checks
+}
+
+func checkDirectories() []doctorCheck {
+	home, err := homedir.Dir()
+	if err != nil {
+		return []doctorCheck{{Name: "home directory", Status: checkFail, Message: err.Error()}}
+	}
+	legacyDir := filepath.Join(home, "."+projectName)
+
+	var checks []doctorCheck
+
+	layout := doctorCheck{Name: "directory layout", Status: checkOK}
+	xdg := os.Getenv("XDG_CONFIG_HOME") != "" || os.Getenv("XDG_DATA_HOME") != ""
+	_, legacyErr := os.Stat(legacyDir)
+	switch {
+	case xdg && legacyErr == nil:
+		layout.Status = checkWarn
+		layout.Message = fmt.Sprintf("XDG directories are in use but legacy data still exists at %s", legacyDir)
+	case xdg:
+		layout.Message = "using XDG directories"
+	default:
+		layout.Message = fmt.Sprintf("using legacy directory %s", legacyDir)
+	}
+	checks = append(checks, layout)
+
+	configDir, err := resolveConfigDir()
+	if err != nil {
+		return append(checks, doctorCheck{Name: "config directory", Status: checkFail, Message: err.Error()})
+	}
+	checks = append(checks,
+		checkPath("config directory", configDir),
+		checkPath("config file", filepath.Join(configDir, "config.toml")),
+	)
+
+	keyringDir, err := resolveKeyringDir()
+	if err != nil {
+		return append(checks, doctorCheck{Name: "keyring directory", Status: checkFail, Message: err.Error()})
+	}
+	if _, err := os.Stat(keyringDir); os.IsNotExist(err) {
+		// The directory is only created once the file backend stores an item.
+		checks = append(checks, doctorCheck{
+			Name:    "keyring directory",
+			Status:  checkOK,
+			Message: fmt.Sprintf("%s (not created yet, only used by the file backend)", keyringDir),
+		})
+	} else {
+		checks = append(checks, checkPath("keyring directory", keyringDir))
+	}
+
+	return checks
+}
+
+// checkPath reports on the existence and permissions of a path that should
+// only be accessible by the current user.
+func checkPath(name, path string) doctorCheck {
+	info, err := os.Stat(path)
+	if err != nil {
+		return doctorCheck{Name: name, Status: checkFail, Message: err.Error()}
+	}
+
+	mode := info.Mode().Perm()
+	if mode&0077 != 0 && runtime.GOOS != "windows" {
+		return doctorCheck{
+			Name:    name,
+			Status:  checkFail,
+			Message: fmt.Sprintf("%s has permissions %04o, it should not be accessible by group or others (run with --fix to repair)", path, mode),
+		}
+	}
+
+	return doctorCheck{Name: name, Status: checkOK, Message: fmt.Sprintf("%s (%04o)", path, mode)}
+}
+
+func checkKeyringBackends() []doctorCheck {
+	var names []string
+	available := keyring.AvailableBackends()
+	for _, b := range available {
+		names = append(names, string(b))
+	}
+
+	backends := doctorCheck{Name: "keyring backends", Status: checkOK, Message: strings.Join(names, ", ")}
+	if len(available) == 0 {
+		backends.Status = checkFail
+		backends.Message = "no keyring backends are available"
+	}
+
+	return []doctorCheck{backends, checkBackendOverride(os.Getenv("CF_VAULT_BACKEND"), available)}
+}
+
+// checkBackendOverride validates the value of CF_VAULT_BACKEND against the
+// backends available on this system.
+func checkBackendOverride(backend string, available []keyring.BackendType) doctorCheck {
+	c := doctorCheck{Name: "CF_VAULT_BACKEND"}
+
+	if backend == "" {
+		c.Status = checkOK
+		c.Message = "not set, the first available backend will be used"
+		return c
+	}
+
+	for _, b := range available {
+		if string(b) == backend {
+			c.Status = checkOK
+			c.Message = fmt.Sprintf("%q is available", backend)
+			return c
+		}
+	}
+
+	c.Status = checkFail
+	c.Message = fmt.Sprintf("%q is not an available backend", backend)
+	return c
+}
+
+func checkConfig() []doctorCheck {
+	configDir, err := resolveConfigDir()
+	if err != nil {
+		return []doctorCheck{{Name: "config", Status: checkFail, Message: err.Error()}}
+	}
+	configPath := filepath.Join(configDir, "config.toml")
+
+	config, err := readConfig(configPath)
+	if err != nil {
+		return []doctorCheck{{Name: "config", Status: checkFail, Message: err.Error()}}
+	}
+
+	if err := config.validate(); err != nil {
+		return []doctorCheck{{Name: "config", Status: checkFail, Message: err.Error()}}
+	}
+
+	if len(config.Profiles) == 0 {
+		return []doctorCheck{{Name: "config", Status: checkWarn, Message: fmt.Sprintf("no profiles found at %s", configPath)}}
+	}
+
+	profileNames := make([]string, 0, len(config.Profiles))
+	for name := range config.Profiles {
+		profileNames = append(profileNames, name)
+	}
+	sort.Strings(profileNames)
+
+	var checks []doctorCheck
+	for _, name := range profileNames {
+		c := doctorCheck{Name: fmt.Sprintf("profile %q", name), Status: checkOK, Message: "valid"}
+		if err := config.Profiles[name].validate(); err != nil {
+			c.Status = checkFail
+			c.Message = err.Error()
+		} else if err := validateSessionDuration(config, config.Profiles[name]); err != nil {
+			c.Status = checkFail
+			c.Message = err.Error()
+		}
+		checks = append(checks, c)
+	}
+
+	return checks
+}
+
+func checkNestedSession() doctorCheck {
+	if session := os.Getenv("CLOUDFLARE_VAULT_SESSION"); session != "" {
+		return doctorCheck{
+			Name:    "nested session",
+			Status:  checkWarn,
+			Message: fmt.Sprintf("running inside the %q session, exec will refuse to start another unless nested_sessions allows it", session),
+		}
+	}
+
+	return doctorCheck{Name: "nested session", Status: checkOK, Message: "not inside a cf-vault session"}
+}
+
+func checkShell() doctorCheck {
+	shell := os.Getenv("SHELL")
+	if shell == "" {
+		return doctorCheck{Name: "shell", Status: checkWarn, Message: "$SHELL is not set, exec without a command will not be able to spawn a shell"}
+	}
+
+	path, err := exec.LookPath(shell)
+	if err != nil {
+		return doctorCheck{Name: "shell", Status: checkFail, Message: fmt.Sprintf("$SHELL (%s) could not be resolved: %s", shell, err)}
+	}
+
+	return doctorCheck{Name: "shell", Status: checkOK, Message: path}
+}
@@ -0,0 +1,130 @@
+package cmd
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/99designs/keyring"
+)
+
+func TestCheckBackendOverride_Unset(t *testing.T) {
+	c := checkBackendOverride("", []keyring.BackendType{keyring.FileBackend})
+	if c.Status != checkOK {
+		t.Errorf("expected ok for unset backend, got %s: %s", c.Status, c.Message)
+	}
+}
+
+func TestCheckBackendOverride_Available(t *testing.T) {
+	c := checkBackendOverride("file", []keyring.BackendType{keyring.PassBackend, keyring.FileBackend})
+	if c.Status != checkOK {
+		t.Errorf("expected ok for available backend, got %s: %s", c.Status, c.Message)
+	}
+}
+
+func TestCheckBackendOverride_Unavailable(t *testing.T) {
+	c := checkBackendOverride("keychain", []keyring.BackendType{keyring.FileBackend})
+	if c.Status != checkFail {
+		t.Errorf("expected fail for unavailable backend, got %s: %s", c.Status, c.Message)
+	}
+}
+
+func TestCheckPath_Permissions(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.toml")
+	if err := os.WriteFile(path, []byte(""), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if c := checkPath("config file", path); c.Status != checkOK {
+		t.Errorf("expected ok for 0600 file, got %s: %s", c.Status, c.Message)
+	}
+
+	if err := os.Chmod(path, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if c := checkPath("config file", path); c.Status != checkFail {
+		t.Errorf("expected fail for 0644 file, got %s: %s", c.Status, c.Message)
+	}
+
+	if c := checkPath("config file", filepath.Join(dir, "missing.toml")); c.Status != checkFail {
+		t.Errorf("expected fail for missing file, got %s: %s", c.Status, c.Message)
+	}
+}
+
+func TestIntegration_Doctor_JSON(t *testing.T) {
+	configDir, _, envVars, cleanup := setupTestEnv(t)
+	defer cleanup()
+
+	writeConfig(t, configDir, `
+[profiles]
+  [profiles.good]
+    auth_type = "api_token"
+  [profiles.bad]
+    auth_type = "api_key"
+`)
+
+	result := runCfVault(t, envVars, "doctor", "--output", "json")
+
+	if result.ExitCode == 0 {
+		t.Fatalf("expected non-zero exit for an invalid profile, got 0\nstdout: %s", result.Stdout)
+	}
+
+	var checks []doctorCheck
+	if err := json.Unmarshal([]byte(result.Stdout), &checks); err != nil {
+		t.Fatalf("expected JSON output, got error %v\nstdout: %s", err, result.Stdout)
+	}
+
+	statuses := map[string]string{}
+	for _, c := range checks {
+		statuses[c.Name] = c.Status
+	}
+	if statuses[`profile "good"`] != checkOK {
+		t.Errorf("expected profile \"good\" to pass, got %q", statuses[`profile "good"`])
+	}
+	if statuses[`profile "bad"`] != checkFail {
+		t.Errorf("expected profile \"bad\" to fail, got %q", statuses[`profile "bad"`])
+	}
+	if statuses["CF_VAULT_BACKEND"] != checkOK {
+		t.Errorf("expected CF_VAULT_BACKEND=file to pass, got %q", statuses["CF_VAULT_BACKEND"])
+	}
+}
+
+func TestIntegration_Doctor_Text(t *testing.T) {
+	configDir, _, envVars, cleanup := setupTestEnv(t)
+	defer cleanup()
+
+	writeConfig(t, configDir, `
+[profiles]
+  [profiles.good]
+    auth_type = "api_token"
+`)
+
+	result := runCfVault(t, envVars, "doctor")
+
+	if !strings.Contains(result.Stdout, `[ok] profile "good": valid`) {
+		t.Errorf("expected checklist line for profile, got: %q", result.Stdout)
+	}
+	if !strings.Contains(result.Stdout, configDir) {
+		t.Errorf("expected config directory %s in output, got: %q", configDir, result.Stdout)
+	}
+}
+
+func TestIntegration_Doctor_YAML(t *testing.T) {
+	configDir, _, envVars, cleanup := setupTestEnv(t)
+	defer cleanup()
+
+	writeConfig(t, configDir, `
+[profiles]
+  [profiles.good]
+    auth_type = "api_token"
+`)
+
+	result := runCfVault(t, envVars, "doctor", "-o", "yaml")
+
+	if !strings.Contains(result.Stdout, "- name: profile \"good\"\n  status: ok\n  message: valid\n") {
+		t.Errorf("expected the profile check as YAML, got: %q", result.Stdout)
+	}
+}
@@ -0,0 +1,97 @@
+package cmd
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	// minSessionDuration is the shortest session worth minting a token for,
+	// anything less expires before most commands have started.
+	minSessionDuration = time.Minute
+	// sessionDurationLimit is the longest session a short lived token can be
+	// requested for regardless of max_session_duration.
+	sessionDurationLimit = 365 * 24 * time.Hour
+)
+
+// parseSessionDuration parses a session_duration or max_session_duration
+// setting and checks it is within the bounds of a short lived token.
+func parseSessionDuration(setting, value string) (time.Duration, error) {
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %q: %w", setting, value, err)
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("%s %q must be positive", setting, value)
+	}
+	if err := checkSessionDurationBounds(setting, d); err != nil {
+		return 0, err
+	}
+	return d, nil
+}
+
+// checkSessionDurationBounds checks d is neither too short to be useful nor
+// longer than a short lived token can last.
+func checkSessionDurationBounds(setting string, d time.Duration) error {
+	if d < minSessionDuration {
+		return fmt.Errorf("%s of %s is too short, it must be at least %s", setting, d, minSessionDuration)
+	}
+	if d > sessionDurationLimit {
+		return fmt.Errorf("%s of %s is too long, it must be at most %s", setting, d, sessionDurationLimit)
+	}
+	return nil
+}
+
+// maxSessionDuration returns the longest session the profile can have. The
+// profile's max_session_duration can only tighten the global one. Both must
+// have been validated.
+func maxSessionDuration(config tomlConfig, p profile) time.Duration {
+	max := sessionDurationLimit
+	for _, value := range []string{config.MaxSessionDuration, p.MaxSessionDuration} {
+		if value == "" {
+			continue
+		}
+		if d, _ := time.ParseDuration(value); d < max {
+			max = d
+		}
+	}
+	return max
+}
+
+// validateSessionDuration checks the profile's session_duration against the
+// maximum set globally or by the profile.
+func validateSessionDuration(config tomlConfig, p profile) error {
+	if p.SessionDuration == "" {
+		return nil
+	}
+
+	d, err := parseSessionDuration("session_duration", p.SessionDuration)
+	if err != nil {
+		return err
+	}
+	if max := maxSessionDuration(config, p); d > max {
+		return fmt.Errorf("session_duration of %s is longer than the max_session_duration of %s", d, max)
+	}
+	return nil
+}
+
+// effectiveSessionDuration returns how long the profile's short lived token
+// lasts. A non-zero override replaces session_duration and is clamped to the
+// maximum. The clamped flag reports whether the override was shortened.
+func effectiveSessionDuration(config tomlConfig, p profile, override time.Duration) (d time.Duration, clamped bool, err error) {
+	if override == 0 {
+		if err := validateSessionDuration(config, p); err != nil {
+			return 0, false, err
+		}
+		d, _ = time.ParseDuration(p.SessionDuration)
+		return d, false, nil
+	}
+
+	if override < minSessionDuration {
+		return 0, false, checkSessionDurationBounds("--duration", override)
+	}
+	if max := maxSessionDuration(config, p); override > max {
+		return max, true, nil
+	}
+	return override, false, nil
+}
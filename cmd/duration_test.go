@@ -0,0 +1,96 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseSessionDuration(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"15x", "invalid session_duration"},
+		{"-15m", "must be positive"},
+		{"30s", "too short"},
+		{"9000h", "too long"},
+	}
+	for _, tt := range tests {
+		_, err := parseSessionDuration("session_duration", tt.value)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%q: expected error containing %q, got: %v", tt.value, tt.want, err)
+		}
+	}
+
+	d, err := parseSessionDuration("session_duration", "15m")
+	if err != nil || d != 15*time.Minute {
+		t.Errorf("expected 15m, got %s (%v)", d, err)
+	}
+}
+
+func TestMaxSessionDuration(t *testing.T) {
+	tests := []struct {
+		name   string
+		global string
+		local  string
+		want   time.Duration
+	}{
+		{"unset", "", "", sessionDurationLimit},
+		{"global", "2h", "", 2 * time.Hour},
+		{"profile", "", "30m", 30 * time.Minute},
+		{"profile tightens global", "2h", "30m", 30 * time.Minute},
+		{"profile can't loosen global", "2h", "4h", 2 * time.Hour},
+	}
+	for _, tt := range tests {
+		got := maxSessionDuration(tomlConfig{MaxSessionDuration: tt.global}, profile{MaxSessionDuration: tt.local})
+		if got != tt.want {
+			t.Errorf("%s: expected %s, got %s", tt.name, tt.want, got)
+		}
+	}
+}
+
+func TestValidateSessionDuration(t *testing.T) {
+	config := tomlConfig{MaxSessionDuration: "1h"}
+
+	if err := validateSessionDuration(config, profile{SessionDuration: "15m"}); err != nil {
+		t.Errorf("expected 15m to be allowed, got: %v", err)
+	}
+	if err := validateSessionDuration(config, profile{}); err != nil {
+		t.Errorf("expected profiles without session_duration to be allowed, got: %v", err)
+	}
+
+	err := validateSessionDuration(config, profile{SessionDuration: "15h"})
+	if err == nil || !strings.Contains(err.Error(), "longer than the max_session_duration of 1h0m0s") {
+		t.Errorf("expected max_session_duration error, got: %v", err)
+	}
+}
+
+func TestEffectiveSessionDuration(t *testing.T) {
+	config := tomlConfig{MaxSessionDuration: "1h"}
+	p := profile{SessionDuration: "15m"}
+
+	tests := []struct {
+		name        string
+		override    time.Duration
+		want        time.Duration
+		wantClamped bool
+	}{
+		{"session_duration", 0, 15 * time.Minute, false},
+		{"override", 30 * time.Minute, 30 * time.Minute, false},
+		{"override clamped", 2 * time.Hour, time.Hour, true},
+	}
+	for _, tt := range tests {
+		got, clamped, err := effectiveSessionDuration(config, p, tt.override)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tt.name, err)
+		}
+		if got != tt.want || clamped != tt.wantClamped {
+			t.Errorf("%s: expected %s (clamped %t), got %s (clamped %t)", tt.name, tt.want, tt.wantClamped, got, clamped)
+		}
+	}
+
+	if _, _, err := effectiveSessionDuration(config, p, 10*time.Second); err == nil || !strings.Contains(err.Error(), "--duration of 10s is too short") {
+		t.Errorf("expected --duration to be rejected, got: %v", err)
+	}
+}
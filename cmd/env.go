@@ -1,6 +1,11 @@
 package cmd
 
-import "strings"
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
 
 // environ is a slice of strings representing the environment, in the form
 // "key=value".
@@ -22,3 +27,170 @@ func (e *environ) Set(key, val string) {
 	e.Unset(key)
 	*e = append(*e, key+"="+val)
 }
+
+// Get returns the value of an environment variable and whether it was present
+func (e environ) Get(key string) (string, bool) {
+	for _, kv := range e {
+		if strings.HasPrefix(kv, key+"=") {
+			return kv[len(key)+1:], true
+		}
+	}
+	return "", false
+}
+
+var envNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// envMapping customises the variables exported for a profile.
+type envMapping struct {
+	// Rename maps an exported variable to the name it is exported as instead.
+	Rename map[string]string `toml:"rename,omitempty"`
+	// Copy maps an exported variable to an additional name it is exported as.
+	Copy map[string]string `toml:"copy,omitempty"`
+	// Suppress lists variables which are not exported at all.
+	Suppress []string `toml:"suppress,omitempty"`
+	// Extra are static, non-secret variables exported alongside the others.
+	Extra map[string]string `toml:"extra,omitempty"`
+	// Allowlist lists inherited variables which are kept even though they
+	// would otherwise be scrubbed or left out by --clean-env.
+	Allowlist []string `toml:"allowlist,omitempty"`
+}
+
+// apply returns a copy of vars with the mapping applied. Copies are made
+// before renames, both of which use the original variable names, followed by
+// suppressions and finally the extra variables. Every renamed variable is
+// removed before any is set so chained renames such as A to B and B to C
+// move both values. A nil mapping returns vars unchanged.
+func (m *envMapping) apply(vars environ) environ {
+	out := append(environ{}, vars...)
+	if m == nil {
+		return out
+	}
+
+	for from, to := range m.Copy {
+		if val, ok := vars.Get(from); ok {
+			out.Set(to, val)
+		}
+	}
+
+	sources := make([]string, 0, len(m.Rename))
+	for from := range m.Rename {
+		if _, ok := vars.Get(from); ok {
+			sources = append(sources, from)
+			out.Unset(from)
+		}
+	}
+	sort.Strings(sources)
+	for _, from := range sources {
+		val, _ := vars.Get(from)
+		out.Set(m.Rename[from], val)
+	}
+
+	for _, key := range m.Suppress {
+		out.Unset(key)
+	}
+
+	for key, val := range m.Extra {
+		out.Set(key, val)
+	}
+
+	return out
+}
+
+// validate checks that every variable name in the mapping is usable.
+func (m *envMapping) validate() error {
+	if m == nil {
+		return nil
+	}
+
+	var names []string
+	for from, to := range m.Rename {
+		names = append(names, from, to)
+	}
+	for from, to := range m.Copy {
+		names = append(names, from, to)
+	}
+	names = append(names, m.Suppress...)
+	names = append(names, m.Allowlist...)
+	for key := range m.Extra {
+		names = append(names, key)
+	}
+
+	for _, name := range names {
+		if !envNamePattern.MatchString(name) {
+			return fmt.Errorf("env: %q is not a valid environment variable name", name)
+		}
+	}
+	return nil
+}
+
+// credentialVarSuffixes are the Cloudflare credential variables, without their
+// `CF_` or `CLOUDFLARE_` prefix, which are scrubbed from the inherited
+// environment.
+var credentialVarSuffixes = []string{
+	"API_KEY",
+	"API_TOKEN",
+	"EMAIL",
+	"API_USER_SERVICE_KEY",
+	"ACCESS_CLIENT_ID",
+	"ACCESS_CLIENT_SECRET",
+}
+
+// baseEnvVars are the only inherited variables passed on with --clean-env.
+var baseEnvVars = []string{
+	"HOME", "USER", "LOGNAME", "PATH", "SHELL", "TERM", "LANG", "LC_ALL", "TZ", "TMPDIR",
+	// Windows
+	"SYSTEMROOT", "COMSPEC", "PATHEXT", "USERPROFILE", "APPDATA", "LOCALAPPDATA", "TEMP", "TMP",
+}
+
+// isCredentialVar reports whether key holds a Cloudflare credential, either
+// directly or as a `_FILE` reference to one.
+func isCredentialVar(key string) bool {
+	name := strings.TrimSuffix(key, "_FILE")
+	for _, prefix := range []string{"CF_", "CLOUDFLARE_"} {
+		if !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		for _, suffix := range credentialVarSuffixes {
+			if name == prefix+suffix {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// allowlist returns the variables kept from the inherited environment. A nil
+// mapping has none.
+func (m *envMapping) allowlist() []string {
+	if m == nil {
+		return nil
+	}
+	return m.Allowlist
+}
+
+// scrub returns a copy of e without any Cloudflare credentials so that stray
+// credentials from the parent shell can't be picked up instead of the
+// profile's. With clean, only baseEnvVars are kept. Variables in allow are
+// always kept. The names of the removed variables are also returned.
+func (e environ) scrub(allow []string, clean bool) (environ, []string) {
+	keep := map[string]bool{}
+	for _, key := range allow {
+		keep[key] = true
+	}
+	base := map[string]bool{}
+	for _, key := range baseEnvVars {
+		base[key] = true
+	}
+
+	out := environ{}
+	var removed []string
+	for _, kv := range e {
+		key, _, _ := strings.Cut(kv, "=")
+		if keep[key] || (!isCredentialVar(key) && (!clean || base[key])) {
+			out = append(out, kv)
+		} else {
+			removed = append(removed, key)
+		}
+	}
+	return out, removed
+}
@@ -1,6 +1,7 @@
 package cmd
 
 import (
+	"reflect"
 	"testing"
 )
 
@@ -60,3 +61,134 @@ func TestEnviron_UnsetMissing(t *testing.T) {
 		t.Errorf("expected 1 entry unchanged, got %d", len(e))
 	}
 }
+
+func TestEnviron_Get(t *testing.T) {
+	e := environ{"FOO=bar", "FOOBAR=baz"}
+	if v, ok := e.Get("FOO"); !ok || v != "bar" {
+		t.Errorf("expected FOO=bar, got %q (present=%v)", v, ok)
+	}
+	if _, ok := e.Get("MISSING"); ok {
+		t.Error("expected MISSING to be absent")
+	}
+}
+
+func TestEnvMapping_ApplyNil(t *testing.T) {
+	var m *envMapping
+	got := m.apply(environ{"CLOUDFLARE_API_TOKEN=abc"})
+	if len(got) != 1 || got[0] != "CLOUDFLARE_API_TOKEN=abc" {
+		t.Errorf("expected vars to be unchanged, got %v", []string(got))
+	}
+}
+
+func TestEnvMapping_Apply(t *testing.T) {
+	m := &envMapping{
+		Rename:   map[string]string{"CLOUDFLARE_API_TOKEN": "TF_VAR_cloudflare_api_token"},
+		Copy:     map[string]string{"CLOUDFLARE_ACCOUNT_ID": "TF_VAR_cloudflare_account_id"},
+		Suppress: []string{"CF_API_TOKEN", "CF_ACCOUNT_ID"},
+		Extra:    map[string]string{"TF_VAR_environment": "production"},
+	}
+	vars := environ{
+		"CLOUDFLARE_API_TOKEN=abc",
+		"CF_API_TOKEN=abc",
+		"CLOUDFLARE_ACCOUNT_ID=123",
+		"CF_ACCOUNT_ID=123",
+	}
+
+	got := m.apply(vars)
+
+	want := map[string]string{
+		"TF_VAR_cloudflare_api_token":  "abc",
+		"CLOUDFLARE_ACCOUNT_ID":        "123",
+		"TF_VAR_cloudflare_account_id": "123",
+		"TF_VAR_environment":           "production",
+	}
+	if len(got) != len(want) {
+		t.Errorf("expected %d variables, got %v", len(want), []string(got))
+	}
+	for k, v := range want {
+		if val, ok := got.Get(k); !ok || val != v {
+			t.Errorf("expected %s=%s, got %q (present=%v)", k, v, val, ok)
+		}
+	}
+	for _, k := range []string{"CLOUDFLARE_API_TOKEN", "CF_API_TOKEN", "CF_ACCOUNT_ID"} {
+		if _, ok := got.Get(k); ok {
+			t.Errorf("expected %s to be removed, got %v", k, []string(got))
+		}
+	}
+
+	// The original variables must not be modified.
+	if len(vars) != 4 {
+		t.Errorf("expected input to be unchanged, got %v", []string(vars))
+	}
+}
+
+func TestEnvMapping_ApplyChainedRename(t *testing.T) {
+	m := &envMapping{Rename: map[string]string{"A": "B", "B": "C"}}
+
+	// Map iteration order is random so apply a few times to catch renames
+	// depending on it.
+	for i := 0; i < 20; i++ {
+		got := m.apply(environ{"A=1", "B=2"})
+
+		if _, ok := got.Get("A"); ok {
+			t.Fatalf("expected A to be renamed, got %v", []string(got))
+		}
+		if val, _ := got.Get("B"); val != "1" {
+			t.Fatalf("expected B=1, got %v", []string(got))
+		}
+		if val, _ := got.Get("C"); val != "2" {
+			t.Fatalf("expected C=2, got %v", []string(got))
+		}
+	}
+}
+
+func TestEnvMapping_Validate(t *testing.T) {
+	valid := &envMapping{Rename: map[string]string{"CLOUDFLARE_API_TOKEN": "TF_VAR_token"}}
+	if err := valid.validate(); err != nil {
+		t.Errorf("expected valid mapping, got: %v", err)
+	}
+
+	invalid := &envMapping{Extra: map[string]string{"NOT-VALID": "x"}}
+	if err := invalid.validate(); err == nil {
+		t.Error("expected error for invalid variable name, got nil")
+	}
+}
+
+func TestIsCredentialVar(t *testing.T) {
+	for _, key := range []string{"CLOUDFLARE_API_KEY", "CF_API_TOKEN", "CF_EMAIL", "CF_ACCESS_CLIENT_SECRET", "CLOUDFLARE_API_TOKEN_FILE", "CF_API_USER_SERVICE_KEY"} {
+		if !isCredentialVar(key) {
+			t.Errorf("expected %s to be a credential variable", key)
+		}
+	}
+	for _, key := range []string{"CLOUDFLARE_ACCOUNT_ID", "CF_VAULT_BACKEND", "MY_CF_API_TOKEN", "API_TOKEN", "HOME"} {
+		if isCredentialVar(key) {
+			t.Errorf("expected %s not to be a credential variable", key)
+		}
+	}
+}
+
+func TestEnviron_Scrub(t *testing.T) {
+	e := environ{
+		"HOME=/home/user",
+		"EDITOR=vim",
+		"CLOUDFLARE_API_KEY=stray",
+		"CF_API_TOKEN=stray",
+		"CF_EMAIL=kept@example.com",
+		"CLOUDFLARE_ACCOUNT_ID=abc",
+	}
+
+	got, removed := e.scrub([]string{"CF_EMAIL"}, false)
+	want := environ{"HOME=/home/user", "EDITOR=vim", "CF_EMAIL=kept@example.com", "CLOUDFLARE_ACCOUNT_ID=abc"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+	if !reflect.DeepEqual(removed, []string{"CLOUDFLARE_API_KEY", "CF_API_TOKEN"}) {
+		t.Errorf("unexpected removed variables %v", removed)
+	}
+
+	got, _ = e.scrub([]string{"EDITOR"}, true)
+	want = environ{"HOME=/home/user", "EDITOR=vim"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected clean environment %v, got %v", want, got)
+	}
+}
@@ -0,0 +1,131 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/cloudflare/cloudflare-go/v6"
+)
+
+// Exit codes returned by cf-vault so wrappers can tell failures apart. Once
+// `exec` has started the command, cf-vault exits with the command's own code
+// instead, so cf-vault's own codes sit above the sysexits.h range (64-78) and
+// below the shell's 126 and up to avoid codes commands commonly exit with.
+const (
+	exitOK                 = 0
+	exitError              = 1
+	exitConfigInvalid      = 80
+	exitProfileNotFound    = 81
+	exitPolicyInvalid      = 82
+	exitKeyringUnavailable = 83
+	exitAPIAuthFailure     = 84
+)
+
+// exitStatusError makes cf-vault exit with code without printing anything
+// further, such as when `exec` passes on the exit code of its command or the
+// failure has already been reported.
+type exitStatusError struct {
+	code int
+}
+
+func (e *exitStatusError) Error() string { return fmt.Sprintf("exit status %d", e.code) }
+
+// configInvalidError is returned when the configuration file can't be read or
+// contains invalid settings.
+type configInvalidError struct {
+	err error
+}
+
+func (e *configInvalidError) Error() string { return e.err.Error() }
+func (e *configInvalidError) Unwrap() error { return e.err }
+
+// profileNotFoundError is returned when a profile isn't in the configuration
+// file.
+type profileNotFoundError struct {
+	profile    string
+	configPath string
+}
+
+func (e *profileNotFoundError) Error() string {
+	return fmt.Sprintf("no profile matching %q found in the configuration file at %s", e.profile, e.configPath)
+}
+
+// policyInvalidError is returned when a profile's short lived token policies
+// are invalid, either locally or when rejected by the API.
+type policyInvalidError struct {
+	err error
+}
+
+func (e *policyInvalidError) Error() string { return e.err.Error() }
+func (e *policyInvalidError) Unwrap() error { return e.err }
+
+// keyringUnavailableError is returned when the keyring can't be opened or the
+// profile's credentials can't be read from it.
+type keyringUnavailableError struct {
+	err error
+}
+
+func (e *keyringUnavailableError) Error() string { return e.err.Error() }
+func (e *keyringUnavailableError) Unwrap() error { return e.err }
+
+// apiAuthError is returned when the Cloudflare API rejects the credentials.
+type apiAuthError struct {
+	err error
+}
+
+func (e *apiAuthError) Error() string { return e.err.Error() }
+func (e *apiAuthError) Unwrap() error { return e.err }
+
+// classifyAPIError wraps err in apiAuthError when the API rejected the
+// credentials so callers get the matching exit code. Other errors are
+// returned as is.
+func classifyAPIError(err error) error {
+	var apiErr *cloudflare.Error
+	if errors.As(err, &apiErr) && (apiErr.StatusCode == http.StatusUnauthorized || apiErr.StatusCode == http.StatusForbidden) {
+		return &apiAuthError{err: err}
+	}
+	return err
+}
+
+// classifyTokenError is classifyAPIError for token creation, where the API
+// rejecting the request points at the profile's policies.
+func classifyTokenError(err error) error {
+	var apiErr *cloudflare.Error
+	if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusBadRequest {
+		return &policyInvalidError{err: err}
+	}
+	return classifyAPIError(err)
+}
+
+// ExitCode returns the exit code cf-vault should exit with for err. The most
+// specific error in the chain wins.
+func ExitCode(err error) int {
+	var (
+		statusErr   *exitStatusError
+		authErr     *apiAuthError
+		keyringErr  *keyringUnavailableError
+		notFoundErr *profileNotFoundError
+		policyErr   *policyInvalidError
+		configErr   *configInvalidError
+	)
+
+	switch {
+	case err == nil:
+		return exitOK
+	case errors.As(err, &statusErr):
+		return statusErr.code
+	case errors.As(err, &authErr):
+		return exitAPIAuthFailure
+	case errors.As(err, &keyringErr):
+		return exitKeyringUnavailable
+	case errors.As(err, &notFoundErr):
+		return exitProfileNotFound
+	case errors.As(err, &policyErr):
+		return exitPolicyInvalid
+	case errors.As(err, &configErr):
+		return exitConfigInvalid
+	default:
+		return exitError
+	}
+}
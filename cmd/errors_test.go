@@ -0,0 +1,87 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestExitCode(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"nil", nil, exitOK},
+		{"untyped", errors.New("boom"), exitError},
+		{"exit status", &exitStatusError{code: 42}, 42},
+		{"config invalid", &configInvalidError{err: errors.New("bad")}, exitConfigInvalid},
+		{"profile not found", &profileNotFoundError{profile: "work"}, exitProfileNotFound},
+		{"policy invalid", &policyInvalidError{err: errors.New("bad")}, exitPolicyInvalid},
+		{"keyring unavailable", &keyringUnavailableError{err: errors.New("locked")}, exitKeyringUnavailable},
+		{"api auth failure", &apiAuthError{err: errors.New("denied")}, exitAPIAuthFailure},
+		{"wrapped", fmt.Errorf("exec: %w", &keyringUnavailableError{err: errors.New("locked")}), exitKeyringUnavailable},
+		{"policy inside config", &configInvalidError{err: fmt.Errorf("profile: %w", &policyInvalidError{err: errors.New("bad")})}, exitPolicyInvalid},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ExitCode(tt.err); got != tt.want {
+				t.Errorf("expected exit code %d, got %d", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestExitCode_ProfileValidate(t *testing.T) {
+	err := profile{AuthType: "api_token", SessionDuration: "15m"}.validate()
+	if got := ExitCode(err); got != exitPolicyInvalid {
+		t.Errorf("expected missing policies to be a policy error, got exit code %d (%v)", got, err)
+	}
+
+	err = profile{AuthType: "password"}.validate()
+	if got := ExitCode(&configInvalidError{err: err}); got != exitConfigInvalid {
+		t.Errorf("expected unknown auth_type to be a config error, got exit code %d (%v)", got, err)
+	}
+}
+
+func TestCreateShortLivedToken_ErrorClassification(t *testing.T) {
+	tests := []struct {
+		status int
+		want   int
+	}{
+		{http.StatusUnauthorized, exitAPIAuthFailure},
+		{http.StatusForbidden, exitAPIAuthFailure},
+		{http.StatusBadRequest, exitPolicyInvalid},
+		{http.StatusNotFound, exitError},
+	}
+
+	for _, tt := range tests {
+		t.Run(http.StatusText(tt.status), func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(tt.status)
+				json.NewEncoder(w).Encode(map[string]interface{}{
+					"success":  false,
+					"errors":   []interface{}{map[string]interface{}{"code": 1000, "message": "rejected"}},
+					"messages": []interface{}{},
+					"result":   nil,
+				})
+			}))
+			defer srv.Close()
+
+			_, err := createShortLivedToken(context.Background(), newTestClient(t, srv.URL), "example", profile{
+				AuthType:        "api_token",
+				SessionDuration: "15m",
+				Policies:        validPolicies(),
+			})
+			if got := ExitCode(err); got != tt.want {
+				t.Errorf("expected exit code %d, got %d (%v)", tt.want, got, err)
+			}
+		})
+	}
+}
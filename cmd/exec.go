@@ -1,25 +1,23 @@
 package cmd
 
 import (
+	"bufio"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
-	"syscall"
 	"time"
 
 	"os/exec"
 
 	"github.com/99designs/keyring"
-	"github.com/cloudflare/cloudflare-go/v6"
-	"github.com/cloudflare/cloudflare-go/v6/shared"
-	"github.com/cloudflare/cloudflare-go/v6/user"
-	"github.com/pelletier/go-toml"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
+	"golang.org/x/term"
 )
 
 var execCmd = &cobra.Command{
@@ -58,7 +56,8 @@ var execCmd = &cobra.Command{
 			keyring.Debug = true
 		}
 	},
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
+		startedAt := time.Now().UTC()
 		env := environ(os.Environ())
 
 		profileName := args[0]
@@ -67,123 +66,434 @@ var execCmd = &cobra.Command{
 		args[len(args)-1] = ""
 		args = args[:len(args)-1]
 
-		// Don't allow nesting of cf-vault sessions, it gets messy.
-		if os.Getenv("CLOUDFLARE_VAULT_SESSION") != "" {
-			log.Fatal("cf-vault sessions shouldn't be nested, unset CLOUDFLARE_VAULT_SESSION to continue or open a new shell session")
-		}
+		exportR2Credentials, _ := cmd.Flags().GetBool("r2-credentials")
+		cleanEnv, _ := cmd.Flags().GetBool("clean-env")
+		yes, _ := cmd.Flags().GetBool("yes")
+		totpCode, _ := cmd.Flags().GetString("totp-code")
+		breakGlass, _ := cmd.Flags().GetBool("break-glass")
+		reason, _ := cmd.Flags().GetString("reason")
+		secretsAsFiles, _ := cmd.Flags().GetBool("secrets-as-files")
+		refresh, _ := cmd.Flags().GetBool("refresh")
+		refreshBefore, _ := cmd.Flags().GetDuration("refresh-before")
+		durationOverride, _ := cmd.Flags().GetDuration("duration")
 
 		log.Debug("using profile: ", profileName)
 
 		configDir, err := resolveConfigDir()
 		if err != nil {
-			log.Fatal(err)
+			return err
 		}
 		configPath := filepath.Join(configDir, "config.toml")
 
-		configData, err := os.ReadFile(configPath)
-		if err != nil {
-			log.Fatal(err)
+		if err := verifyPermissions(configDir); err != nil {
+			return err
 		}
 
-		config := tomlConfig{}
-		err = toml.Unmarshal(configData, &config)
+		config, err := readConfig(configPath)
 		if err != nil {
-			log.Fatal(err)
+			return err
 		}
 
 		if _, ok := config.Profiles[profileName]; !ok {
-			log.Fatalf("no profile matching %q found in the configuration file at %s", profileName, configPath)
+			return &profileNotFoundError{profile: profileName, configPath: configPath}
 		}
 
 		profile := config.Profiles[profileName]
+		if err := profile.validate(); err != nil {
+			return &configInvalidError{err: fmt.Errorf("profile %q is invalid: %w", profileName, err)}
+		}
+
+		if err := config.validate(); err != nil {
+			return &configInvalidError{err: fmt.Errorf("invalid configuration: %w", err)}
+		}
+		auditHMACRequired = config.AuditHMAC
+
+		// Settle how long the short lived token lasts before anything else so a
+		// bad duration never reaches the API.
+		if durationOverride != 0 && profile.SessionDuration == "" {
+			return fmt.Errorf("--duration requires profile %q to have session_duration set", profileName)
+		}
+		if profile.SessionDuration != "" {
+			d, clamped, err := effectiveSessionDuration(config, profile, durationOverride)
+			if err != nil {
+				return &configInvalidError{err: fmt.Errorf("profile %q: %w", profileName, err)}
+			}
+			if clamped {
+				log.Warnf("--duration %s is longer than the max_session_duration of %s for %q, using %s", durationOverride, d, profileName, d)
+			}
+			profile.SessionDuration = d.String()
+			profile.TokenNameTemplate = tokenNameTemplate(config, profile)
+		}
+
+		// Nesting cf-vault sessions gets messy so it is refused unless the
+		// nested_sessions policy says otherwise.
+		if currentSession := os.Getenv("CLOUDFLARE_VAULT_SESSION"); currentSession != "" {
+			switch policy := nestedSessionPolicy(config, profile); {
+			case policy == nestedSessionsReplace:
+				log.Warnf("replacing the %q session with %q, clearing its Cloudflare variables (nested_sessions = %q)", currentSession, profileName, policy)
+				env = env.withoutCloudflareVars()
+			case policy == nestedSessionsAllowSameProfile && currentSession == profileName:
+				log.Warnf("nesting another %q session, clearing the outer session's variables (nested_sessions = %q)", profileName, policy)
+				env = env.withoutSessionVars()
+			default:
+				return fmt.Errorf("cf-vault sessions shouldn't be nested, unset CLOUDFLARE_VAULT_SESSION to continue or open a new shell session (inside %q, nested_sessions = %q)", currentSession, policy)
+			}
+		}
+
+		// Only the profile's credentials should reach the command.
+		var scrubbed []string
+		env, scrubbed = env.scrub(profile.Env.allowlist(), cleanEnv)
+		if len(scrubbed) > 0 {
+			log.Debugf("removed inherited variables: %s", strings.Join(scrubbed, ", "))
+		}
+
+		// R2 credentials are derived from the short lived token so we need one to
+		// be minted and an account to point the endpoint at.
+		if exportR2Credentials && (profile.SessionDuration == "" || (profile.AccountID == "" && profile.AccountName == "")) {
+			return fmt.Errorf("--r2-credentials requires profile %q to have session_duration and account_id set", profileName)
+		}
+		// The R2 key pair is derived from the token at exec and can't follow
+		// it when it is replaced.
+		if exportR2Credentials && refresh {
+			return errors.New("--r2-credentials can't be used with --refresh as the R2 credentials aren't refreshed")
+		}
+
+		if refresh {
+			if profile.SessionDuration == "" {
+				return fmt.Errorf("--refresh requires profile %q to have session_duration set", profileName)
+			}
+			d, _ := time.ParseDuration(profile.SessionDuration)
+			if refreshBefore == 0 {
+				refreshBefore = defaultRefreshBefore(d)
+			}
+			if refreshBefore < 0 || refreshBefore >= d {
+				return fmt.Errorf("--refresh-before must be between 0 and the session duration of %s", d)
+			}
+		}
+
+		if breakGlass && strings.TrimSpace(reason) == "" {
+			return errors.New("--break-glass requires a --reason")
+		}
+
+		// Usage outside of the allowed window is refused unless the user
+		// explicitly breaks glass, which is recorded once the keyring is open.
+		breakingGlass := false
+		// ID of the short lived token, if one is minted, passed to the hooks.
+		var tokenID string
+
+		// refuse records a session that was refused or failed before the
+		// command started as an exec event with the error, then returns it.
+		// With audit_hmac, refusals before the keyring is open can't be
+		// signed and aren't recorded.
+		refuse := func(err error, secrets ...string) error {
+			appendAuditRecord(auditRecord{
+				Event:      auditEventExec,
+				Profile:    profileName,
+				Command:    redactCommandLine(os.Args, append(secrets, totpCode)),
+				TokenID:    tokenID,
+				BreakGlass: breakingGlass,
+				Error:      err.Error(),
+			})
+			return err
+		}
+
+		if !profile.AllowedWindow.contains(time.Now()) {
+			if !breakGlass {
+				return refuse(fmt.Errorf("profile %q may only be used %s, pass --break-glass with a --reason to use it anyway", profileName, profile.AllowedWindow))
+			}
+			breakingGlass = true
+			log.Warnf("BREAK GLASS: using profile %q outside of its allowed window (%s), reason: %s", profileName, profile.AllowedWindow, reason)
+		}
+
+		// Confirm sensitive profiles before the keyring is opened so nothing
+		// is unlocked or minted by accident.
+		if profile.RequireConfirmation {
+			switch {
+			case yes:
+				log.Debugf("profile %q confirmed with --yes", profileName)
+			case !term.IsTerminal(int(os.Stdin.Fd())):
+				return refuse(fmt.Errorf("profile %q requires confirmation, pass --yes to confirm when not running interactively", profileName))
+			default:
+				if err := confirmProfile(os.Stdin, os.Stderr, profileName, profile.ConfirmationMessage); err != nil {
+					return refuse(err)
+				}
+			}
+		}
 
 		ring, err := openKeyring()
 		if err != nil {
-			log.Fatalf("failed to open keyring backend: %s", strings.ToLower(err.Error()))
+			return refuse(&keyringUnavailableError{err: fmt.Errorf("failed to open keyring backend: %s", strings.ToLower(err.Error()))})
+		}
+
+		if config.AuditHMAC {
+			if err := useAuditKey(ring); err != nil {
+				log.Warnf("failed to load audit HMAC key: %s", err)
+			}
+		}
+
+		if breakingGlass {
+			appendAuditRecord(auditRecord{
+				Event:      auditEventBreakGlass,
+				Profile:    profileName,
+				Command:    redactCommandLine(os.Args, []string{totpCode}),
+				BreakGlass: true,
+				Reason:     reason,
+			})
+		}
+
+		// The second factor is checked before the credential is read from the
+		// keyring.
+		if profile.TOTP {
+			seed, err := ring.Get(totpKeyringKey(profileName))
+			if err != nil {
+				return refuse(&keyringUnavailableError{err: fmt.Errorf("failed to get TOTP secret from keyring: %s", strings.ToLower(err.Error()))})
+			}
+
+			if totpCode == "" {
+				if !term.IsTerminal(int(os.Stdin.Fd())) {
+					return refuse(fmt.Errorf("profile %q requires a TOTP code, pass --totp-code when not running interactively", profileName))
+				}
+				fmt.Fprint(os.Stderr, "TOTP code: ")
+				totpCode, _ = bufio.NewReader(os.Stdin).ReadString('\n')
+			}
+
+			valid, err := validateTOTP(string(seed.Data), totpCode, time.Now())
+			if err != nil {
+				return refuse(err)
+			}
+			if !valid {
+				return refuse(fmt.Errorf("invalid TOTP code for profile %q", profileName))
+			}
 		}
 
 		keychain, err := ring.Get(fmt.Sprintf("%s-%s", profileName, profile.AuthType))
 		if err != nil {
-			log.Fatalf("failed to get item from keyring: %s", strings.ToLower(err.Error()))
+			return refuse(&keyringUnavailableError{err: fmt.Errorf("failed to get item from keyring: %s", strings.ToLower(err.Error()))})
 		}
 
 		env.Set("CLOUDFLARE_VAULT_SESSION", profileName)
 
-		// Not using short lived tokens so set the static API token or API key.
-		if profile.SessionDuration == "" {
+		// Variables for the profile are collected separately so that the
+		// profile's env mapping can be applied before they are exported.
+		exported := environ{}
+		// Values of the exported variables which are secret, used to decide
+		// which variables are written to files with --secrets-as-files.
+		var secrets []string
+		// Only set when the short lived token is refreshed during the session.
+		var refresher *tokenRefresher
+		// Deletes the short lived token when the session is abandoned before
+		// the command starts so it doesn't stay valid until it expires.
+		revokeToken := func() {}
+
+		if profile.AccountName != "" || profile.ZoneName != "" {
+			cfClient := newClient(string(keychain.Data), profile.AuthType, profile.Email)
+
+			if profile.AccountName != "" {
+				profile.AccountID, err = resolveAccountID(context.Background(), cfClient, profile.AccountName)
+				if err != nil {
+					return refuse(classifyAPIError(err), string(keychain.Data))
+				}
+				log.Debugf("resolved account %q to %s", profile.AccountName, profile.AccountID)
+			}
+
+			if profile.ZoneName != "" {
+				profile.ZoneID, err = resolveZoneID(context.Background(), cfClient, profile.ZoneName, profile.AccountID)
+				if err != nil {
+					return refuse(classifyAPIError(err), string(keychain.Data))
+				}
+				log.Debugf("resolved zone %q to %s", profile.ZoneName, profile.ZoneID)
+			}
+		}
+
+		if profile.AccountID != "" {
+			exported.Set("CLOUDFLARE_ACCOUNT_ID", profile.AccountID)
+			exported.Set("CF_ACCOUNT_ID", profile.AccountID)
+		}
+		if profile.ZoneID != "" {
+			exported.Set("CLOUDFLARE_ZONE_ID", profile.ZoneID)
+			exported.Set("CF_ZONE_ID", profile.ZoneID)
+		}
+
+		// Not using short lived tokens so set the static credentials.
+		if profile.AuthType == "access_service_token" {
+			serviceToken := accessServiceToken{}
+			if err := json.Unmarshal(keychain.Data, &serviceToken); err != nil {
+				return refuse(fmt.Errorf("failed to decode Access service token from keyring: %s", err), string(keychain.Data))
+			}
+			exported.Set("CF_ACCESS_CLIENT_ID", serviceToken.ClientID)
+			exported.Set("CF_ACCESS_CLIENT_SECRET", serviceToken.ClientSecret)
+			secrets = append(secrets, serviceToken.ClientSecret)
+		} else if profile.AuthType == "origin_ca_key" {
+			exported.Set("CLOUDFLARE_API_USER_SERVICE_KEY", string(keychain.Data))
+			exported.Set("CF_API_USER_SERVICE_KEY", string(keychain.Data))
+			secrets = append(secrets, string(keychain.Data))
+		} else if profile.SessionDuration == "" {
 			if profile.AuthType == "api_key" {
-				env.Set("CLOUDFLARE_EMAIL", profile.Email)
-				env.Set("CF_EMAIL", profile.Email)
+				exported.Set("CLOUDFLARE_EMAIL", profile.Email)
+				exported.Set("CF_EMAIL", profile.Email)
 			}
-			env.Set(fmt.Sprintf("CLOUDFLARE_%s", strings.ToUpper(profile.AuthType)), string(keychain.Data))
-			env.Set(fmt.Sprintf("CF_%s", strings.ToUpper(profile.AuthType)), string(keychain.Data))
+			exported.Set(fmt.Sprintf("CLOUDFLARE_%s", strings.ToUpper(profile.AuthType)), string(keychain.Data))
+			exported.Set(fmt.Sprintf("CF_%s", strings.ToUpper(profile.AuthType)), string(keychain.Data))
+			secrets = append(secrets, string(keychain.Data))
 		} else {
 			cfClient := newClient(string(keychain.Data), profile.AuthType, profile.Email)
 
-			tokenPolicies := []shared.TokenPolicyParam{}
-			for _, p := range profile.Policies {
-				var groups []shared.TokenPolicyPermissionGroupParam
-				for _, g := range p.PermissionGroups {
-					groups = append(groups, shared.TokenPolicyPermissionGroupParam{
-						ID: cloudflare.F(g.ID),
-					})
+			shortLivedToken, err := createShortLivedToken(context.Background(), cfClient, profileName, profile)
+			if err != nil {
+				return refuse(fmt.Errorf("failed to create API token: %w", err), string(keychain.Data))
+			}
+
+			appendAuditRecord(auditRecord{
+				Event:          auditEventTokenMint,
+				Profile:        profileName,
+				Command:        redactCommandLine(os.Args, []string{string(keychain.Data), shortLivedToken.Value, totpCode}),
+				TokenID:        shortLivedToken.ID,
+				TokenExpiresOn: &shortLivedToken.ExpiresOn,
+				BreakGlass:     breakingGlass,
+			})
+
+			if shortLivedToken.Value != "" {
+				exported.Set("CLOUDFLARE_API_TOKEN", shortLivedToken.Value)
+				exported.Set("CF_API_TOKEN", shortLivedToken.Value)
+				secrets = append(secrets, shortLivedToken.Value)
+			}
+
+			if exportR2Credentials {
+				accessKeyID, secretAccessKey := r2Credentials(shortLivedToken.ID, shortLivedToken.Value)
+				exported.Set("AWS_ACCESS_KEY_ID", accessKeyID)
+				exported.Set("AWS_SECRET_ACCESS_KEY", secretAccessKey)
+				exported.Set("AWS_ENDPOINT_URL_S3", r2Endpoint(profile.AccountID))
+				secrets = append(secrets, secretAccessKey)
+			}
+
+			env.Set("CLOUDFLARE_SESSION_EXPIRY", strconv.Itoa(int(shortLivedToken.ExpiresOn.Unix())))
+			tokenID = shortLivedToken.ID
+			revokeToken = func() {
+				if err := deleteShortLivedToken(context.Background(), cfClient, profile, shortLivedToken.ID); err != nil {
+					log.Warnf("failed to delete the unused short lived token %s, it remains valid until %s: %s", shortLivedToken.ID, shortLivedToken.ExpiresOn.Local().Format(time.Kitchen), err)
 				}
-				resources := shared.TokenPolicyResourcesIAMResourcesTypeObjectStringParam{}
-				for k, v := range p.Resources {
-					if s, ok := v.(string); ok {
-						resources[k] = s
-					} else {
-						resources[k] = fmt.Sprintf("%v", v)
-					}
+			}
+
+			if refresh {
+				refresher = &tokenRefresher{
+					client:        cfClient,
+					profile:       profile,
+					profileName:   profileName,
+					refreshBefore: refreshBefore,
+					current:       shortLivedToken,
+					commandLine:   redactCommandLine(os.Args, []string{string(keychain.Data), totpCode}),
 				}
-				tokenPolicies = append(tokenPolicies, shared.TokenPolicyParam{
-					Effect:           cloudflare.F(shared.TokenPolicyEffect(p.Effect)),
-					PermissionGroups: cloudflare.F(groups),
-					Resources:        cloudflare.F[shared.TokenPolicyResourcesUnionParam](resources),
-				})
 			}
+		}
+
+		mapped := profile.Env.apply(exported)
 
-			parsedSessionDuration, err := time.ParseDuration(profile.SessionDuration)
+		var secretsDir string
+		if secretsAsFiles || refresher != nil {
+			secretsDir, err = newSecretsDir()
 			if err != nil {
-				log.Fatal(err)
+				revokeToken()
+				return refuse(err, append(secrets, string(keychain.Data))...)
 			}
-			now, _ := time.Parse(time.RFC3339, time.Now().UTC().Format(time.RFC3339))
-			tokenExpiry := now.Add(time.Second * time.Duration(parsedSessionDuration.Seconds()))
+		}
 
-			shortLivedToken, err := cfClient.User.Tokens.New(context.Background(), user.TokenNewParams{
-				Name:      cloudflare.F(fmt.Sprintf("%s-%d", projectName, tokenExpiry.Unix())),
-				NotBefore: cloudflare.F(now),
-				ExpiresOn: cloudflare.F(tokenExpiry),
-				Policies:  cloudflare.F(tokenPolicies),
-			})
-			if err != nil {
-				log.Fatalf("failed to create API token: %s", err)
+		if refresher != nil {
+			refresher.dir = secretsDir
+			if err := refresher.writeFiles(); err != nil {
+				os.RemoveAll(secretsDir)
+				revokeToken()
+				return refuse(fmt.Errorf("failed to write token file: %s", err), append(secrets, string(keychain.Data))...)
 			}
+			env.Set("CLOUDFLARE_VAULT_TOKEN_FILE", refresher.tokenFile())
+			env.Set("CLOUDFLARE_VAULT_EXPIRY_FILE", refresher.expiryFile())
+		}
 
-			if shortLivedToken.Value != "" {
-				env.Set("CLOUDFLARE_API_TOKEN", shortLivedToken.Value)
-				env.Set("CF_API_TOKEN", shortLivedToken.Value)
+		if secretsAsFiles {
+			replaced, err := writeSecretFiles(secretsDir, &mapped, secrets)
+			if err != nil {
+				os.RemoveAll(secretsDir)
+				revokeToken()
+				return refuse(err, append(secrets, string(keychain.Data))...)
 			}
+			// Don't let an inherited value shadow the file.
+			for _, key := range replaced {
+				env.Unset(key)
+			}
+			log.Debugf("wrote secrets for %s to %s", strings.Join(replaced, ", "), secretsDir)
+		}
 
-			env.Set("CLOUDFLARE_SESSION_EXPIRY", strconv.Itoa(int(tokenExpiry.Unix())))
+		// Hooks get the session details but not the credentials, including
+		// the refreshed token's file.
+		hookEnv := append(environ{}, env...)
+		hookEnv.Unset("CLOUDFLARE_VAULT_TOKEN_FILE")
+		if tokenID != "" {
+			hookEnv.Set("CLOUDFLARE_VAULT_TOKEN_ID", tokenID)
+		}
+
+		for _, kv := range mapped {
+			key, value, _ := strings.Cut(kv, "=")
+			env.Set(key, value)
 		}
 
 		// Should a command not be provided, drop into a fresh shell with the
 		// credentials populated alongside the existing env.
 		if len(args) == 0 {
 			log.Debug("launching new shell with credentials populated")
-			syscall.Exec(os.Getenv("SHELL"), []string{os.Getenv("SHELL")}, env)
+			args = []string{os.Getenv("SHELL")}
 		}
 
 		executable := args[0]
 		pathtoExec, err := exec.LookPath(executable)
 		if err != nil {
-			log.Fatalf("couldn't find the executable '%s': %s", pathtoExec, err.Error())
+			os.RemoveAll(secretsDir)
+			revokeToken()
+			return refuse(fmt.Errorf("couldn't find the executable '%s': %s", executable, err.Error()), append(secrets, string(keychain.Data))...)
 		}
 
 		log.Debugf("found executable %s", pathtoExec)
 		log.Debugf("executing command: %s", strings.Join(args, " "))
 
-		syscall.Exec(pathtoExec, args, env)
+		if err := profile.Hooks.runPreExec(hookEnv); err != nil {
+			os.RemoveAll(secretsDir)
+			revokeToken()
+			return refuse(err, append(secrets, string(keychain.Data))...)
+		}
+
+		// cf-vault stays the parent of the command rather than replacing
+		// itself so that it can refresh the token while the command runs,
+		// then run the post-exec hooks and remove the secret files after.
+		ctx, cancel := context.WithCancel(context.Background())
+		if refresher != nil {
+			go refresher.run(ctx)
+		}
+		exitCode, err := runCommand(pathtoExec, args, env)
+		cancel()
+
+		// The command never started, such as a script without a shebang, so
+		// the session is abandoned like a failing pre-exec hook.
+		if err != nil {
+			os.RemoveAll(secretsDir)
+			revokeToken()
+			return refuse(fmt.Errorf("failed to run %s: %s", executable, err), append(secrets, string(keychain.Data))...)
+		}
+
+		appendAuditRecord(auditRecord{
+			Event:      auditEventExec,
+			Profile:    profileName,
+			Command:    redactCommandLine(os.Args, append(secrets, string(keychain.Data), totpCode)),
+			TokenID:    tokenID,
+			StartedAt:  &startedAt,
+			ExitCode:   &exitCode,
+			BreakGlass: breakingGlass,
+		})
+
+		hookEnv.Set("CLOUDFLARE_VAULT_EXIT_CODE", strconv.Itoa(exitCode))
+		profile.Hooks.runPostExec(hookEnv)
+
+		os.RemoveAll(secretsDir)
+		if exitCode != 0 {
+			return &exitStatusError{code: exitCode}
+		}
+		return nil
 	},
 }
@@ -0,0 +1,82 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// hooks are commands run around the command started by `exec`. Each hook is
+// run by the shell (`sh -c`, or `cmd /C` on Windows).
+type hooks struct {
+	// PreExec run in order before the command starts. The session is aborted
+	// if any of them fail.
+	PreExec []string `toml:"pre_exec,omitempty"`
+	// PostExec run in order after the command exits. Failures are logged but
+	// don't change the exit code.
+	PostExec []string `toml:"post_exec,omitempty"`
+}
+
+// validate checks that none of the hooks are empty.
+func (h *hooks) validate() error {
+	if h == nil {
+		return nil
+	}
+
+	for _, c := range append(append([]string{}, h.PreExec...), h.PostExec...) {
+		if strings.TrimSpace(c) == "" {
+			return fmt.Errorf("hooks: commands cannot be empty")
+		}
+	}
+	return nil
+}
+
+// runPreExec runs each pre-exec hook, stopping at the first failure.
+func (h *hooks) runPreExec(env []string) error {
+	if h == nil {
+		return nil
+	}
+
+	for _, c := range h.PreExec {
+		if err := runHook(c, env); err != nil {
+			return fmt.Errorf("pre_exec hook %q failed: %w", c, err)
+		}
+	}
+	return nil
+}
+
+// runPostExec runs every post-exec hook, logging any which fail.
+func (h *hooks) runPostExec(env []string) {
+	if h == nil {
+		return
+	}
+
+	for _, c := range h.PostExec {
+		if err := runHook(c, env); err != nil {
+			log.Warnf("post_exec hook %q failed: %s", c, err)
+		}
+	}
+}
+
+// runHook runs a single hook attached to the current terminal so it can
+// prompt for confirmation.
+func runHook(command string, env []string) error {
+	log.Debugf("running hook: %s", command)
+
+	var c *exec.Cmd
+	if runtime.GOOS == "windows" {
+		c = exec.Command("cmd", "/C", command)
+	} else {
+		c = exec.Command("sh", "-c", command)
+	}
+	c.Env = env
+	c.Stdin = os.Stdin
+	c.Stdout = os.Stdout
+	c.Stderr = os.Stderr
+
+	return c.Run()
+}
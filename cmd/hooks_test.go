@@ -0,0 +1,49 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestHooksValidate(t *testing.T) {
+	var h *hooks
+	if err := h.validate(); err != nil {
+		t.Errorf("expected nil hooks to be valid, got %v", err)
+	}
+	if err := (&hooks{PreExec: []string{"true"}, PostExec: []string{"true"}}).validate(); err != nil {
+		t.Errorf("expected hooks to be valid, got %v", err)
+	}
+	if err := (&hooks{PostExec: []string{" "}}).validate(); err == nil {
+		t.Error("expected an error for an empty hook")
+	}
+}
+
+func TestHooksRun(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("hooks are run with sh in this test")
+	}
+
+	out := filepath.Join(t.TempDir(), "out")
+	env := append(os.Environ(), "OUT="+out)
+
+	h := &hooks{
+		PreExec:  []string{`echo first >> "$OUT"`, "exit 1", `echo skipped >> "$OUT"`},
+		PostExec: []string{"exit 1", `echo post >> "$OUT"`},
+	}
+
+	if err := h.runPreExec(env); err == nil || !strings.Contains(err.Error(), `pre_exec hook "exit 1" failed`) {
+		t.Errorf("expected the failing pre_exec hook to be reported, got %v", err)
+	}
+	h.runPostExec(env)
+
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "first\npost\n" {
+		t.Errorf("expected pre_exec to stop at the failure and post_exec to continue, got %q", data)
+	}
+}
@@ -2,12 +2,19 @@ package cmd
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"os/exec"
+	"path"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/99designs/keyring"
 )
@@ -251,6 +258,61 @@ func TestIntegration_Exec_MissingProfileArg(t *testing.T) {
 	}
 }
 
+func TestIntegration_List_StructuredOutput(t *testing.T) {
+	configDir, _, envVars, cleanup := setupTestEnv(t)
+	defer cleanup()
+
+	writeConfig(t, configDir, `
+[profiles]
+  [profiles.zeta]
+    auth_type = "api_token"
+    session_duration = "15m"
+    template = "read-only"
+    [[profiles.zeta.policies]]
+      effect = "allow"
+      [profiles.zeta.policies.resources]
+        "com.cloudflare.api.account.*" = "*"
+      [[profiles.zeta.policies.permission_groups]]
+        id = "c8fed203ed3043cba015a93ad1616f1f"
+  [profiles.alpha]
+    email = "alpha@example.com"
+    auth_type = "api_key"
+`)
+
+	result := runCfVault(t, envVars, "list", "--output", "json")
+	if result.ExitCode != 0 {
+		t.Fatalf("expected exit 0, got %d\nstderr: %s", result.ExitCode, result.Stderr)
+	}
+
+	var listings []map[string]interface{}
+	if err := json.Unmarshal([]byte(result.Stdout), &listings); err != nil {
+		t.Fatalf("expected JSON output, got error %v\nstdout: %s", err, result.Stdout)
+	}
+	if len(listings) != 2 || listings[0]["name"] != "alpha" || listings[1]["name"] != "zeta" {
+		t.Fatalf("expected profiles sorted by name, got %v", listings)
+	}
+	if listings[0]["email"] != "alpha@example.com" {
+		t.Errorf("expected the email to be listed, got %v", listings[0])
+	}
+	zeta := listings[1]
+	if zeta["session_duration"] != "15m" || zeta["template"] != "read-only" || zeta["policy_count"] != float64(1) {
+		t.Errorf("expected session_duration, template and policy_count to be listed, got %v", zeta)
+	}
+
+	result = runCfVault(t, envVars, "list", "-o", "yaml")
+	if result.ExitCode != 0 {
+		t.Fatalf("expected exit 0, got %d\nstderr: %s", result.ExitCode, result.Stderr)
+	}
+	if !strings.HasPrefix(result.Stdout, "- auth_type: api_key\n") || !strings.Contains(result.Stdout, "  name: zeta\n") {
+		t.Errorf("unexpected YAML output:\n%s", result.Stdout)
+	}
+
+	result = runCfVault(t, envVars, "list", "--output", "xml")
+	if result.ExitCode == 0 || !strings.Contains(result.Stderr, "unknown output format") {
+		t.Errorf("expected an unknown output format error, got exit %d\nstderr: %s", result.ExitCode, result.Stderr)
+	}
+}
+
 func TestIntegration_Exec_ProfileNotFound(t *testing.T) {
 	configDir, _, envVars, cleanup := setupTestEnv(t)
 	defer cleanup()
@@ -263,14 +325,123 @@ func TestIntegration_Exec_ProfileNotFound(t *testing.T) {
 
 	result := runCfVault(t, envVars, "exec", "nonexistent-profile", "--", "env")
 
-	if result.ExitCode == 0 {
-		t.Fatalf("expected non-zero exit for unknown profile, got 0")
+	if result.ExitCode != exitProfileNotFound {
+		t.Fatalf("expected exit %d for unknown profile, got %d", exitProfileNotFound, result.ExitCode)
 	}
 	if !strings.Contains(result.Stderr, "nonexistent-profile") {
 		t.Errorf("expected profile name in error output, got stderr=%q", result.Stderr)
 	}
 }
 
+func TestIntegration_Exec_ExitCodes(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+		env    []string
+		want   int
+	}{
+		{"config invalid", "[profiles\n", nil, exitConfigInvalid},
+		{"profile invalid", strings.Replace(shortLivedProfile, `"api_token"`, `"password"`, 1), nil, exitConfigInvalid},
+		{"policy invalid", strings.Replace(shortLivedProfile, `effect = "allow"`, `effect = "permit"`, 1), nil, exitPolicyInvalid},
+		{"keyring unavailable", shortLivedProfile, []string{"CF_VAULT_BACKEND=no-such-backend"}, exitKeyringUnavailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configDir, envVars, server, cleanup := setupShortLivedTestEnv(t)
+			defer cleanup()
+
+			writeConfig(t, configDir, tt.config)
+
+			result := runCfVault(t, append(envVars, tt.env...), "exec", "shortlived", "--", "true")
+
+			if result.ExitCode != tt.want {
+				t.Errorf("expected exit %d, got %d\nstderr: %s", tt.want, result.ExitCode, result.Stderr)
+			}
+			if n := len(server.Requests()); n != 0 {
+				t.Errorf("expected no token to be minted, got %d requests", n)
+			}
+		})
+	}
+}
+
+func TestIntegration_Exec_APIAuthFailure(t *testing.T) {
+	configDir, keyringDir, envVars, cleanup := setupTestEnv(t)
+	defer cleanup()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success":  false,
+			"errors":   []interface{}{map[string]interface{}{"code": 9109, "message": "Unauthorized to access requested resource"}},
+			"messages": []interface{}{},
+			"result":   nil,
+		})
+	}))
+	defer srv.Close()
+
+	filtered := make([]string, 0, len(envVars))
+	for _, e := range envVars {
+		if !strings.HasPrefix(e, "CLOUDFLARE_VAULT_SESSION=") {
+			filtered = append(filtered, e)
+		}
+	}
+
+	writeConfig(t, configDir, shortLivedProfile)
+	writeKeyringItem(t, keyringDir, "shortlived-api_token", []byte("abcdefghijklmnopqrstuvwxyzABCDEF12345678"))
+
+	result := runCfVault(t, append(filtered, "CLOUDFLARE_BASE_URL="+srv.URL), "exec", "shortlived", "--", "true")
+
+	if result.ExitCode != exitAPIAuthFailure {
+		t.Fatalf("expected exit %d, got %d\nstderr: %s", exitAPIAuthFailure, result.ExitCode, result.Stderr)
+	}
+	if !strings.Contains(result.Stderr, "failed to create API token") {
+		t.Errorf("expected token creation error, got:\n%s", result.Stderr)
+	}
+}
+
+func TestIntegration_Exec_CommandExitCode(t *testing.T) {
+	_, envVars, _, cleanup := setupShortLivedTestEnv(t)
+	defer cleanup()
+
+	result := runCfVault(t, envVars, "exec", "shortlived", "--", "sh", "-c", "exit 42")
+
+	if result.ExitCode != 42 {
+		t.Fatalf("expected the command's exit code 42, got %d\nstderr: %s", result.ExitCode, result.Stderr)
+	}
+	if strings.Contains(result.Stderr, "exit status") {
+		t.Errorf("expected no error to be logged for the command's exit code, got:\n%s", result.Stderr)
+	}
+}
+
+func TestIntegration_Exec_KilledBySignal(t *testing.T) {
+	_, envVars, _, cleanup := setupShortLivedTestEnv(t)
+	defer cleanup()
+
+	result := runCfVault(t, envVars, "exec", "shortlived", "--", "sh", "-c", "kill -TERM $$")
+
+	if result.ExitCode != 128+15 {
+		t.Fatalf("expected exit %d for a command killed by SIGTERM, got %d\nstderr: %s", 128+15, result.ExitCode, result.Stderr)
+	}
+}
+
+func TestIntegration_Exec_InterruptNotForwarded(t *testing.T) {
+	_, envVars, _, cleanup := setupShortLivedTestEnv(t)
+	defer cleanup()
+
+	// The terminal already delivers SIGINT to the command, so cf-vault must
+	// survive it without passing on a second one.
+	result := runCfVault(t, envVars, "exec", "shortlived", "--", "sh", "-c", "kill -INT $PPID; sleep 1; echo survived")
+
+	if result.ExitCode != 0 {
+		t.Fatalf("expected exit 0, got %d\nstderr: %s", result.ExitCode, result.Stderr)
+	}
+	if !strings.Contains(result.Stdout, "survived") {
+		t.Errorf("expected the command to survive SIGINT sent to cf-vault, got:\n%s", result.Stdout)
+	}
+}
+
 func TestIntegration_Exec_NestedSessionRejected(t *testing.T) {
 	configDir, _, envVars, cleanup := setupTestEnv(t)
 	defer cleanup()
@@ -402,3 +573,1485 @@ func TestIntegration_Exec_APIToken(t *testing.T) {
 		t.Errorf("expected CLOUDFLARE_VAULT_SESSION=tokenprofile in output, got:\n%s", result.Stdout)
 	}
 }
+
+func TestIntegration_List_InsecureConfigRejected(t *testing.T) {
+	configDir, _, envVars, cleanup := setupTestEnv(t)
+	defer cleanup()
+
+	writeConfig(t, configDir, `
+[profiles]
+  [profiles.myprofile]
+    auth_type = "api_token"
+`)
+	if err := os.Chmod(filepath.Join(configDir, "config.toml"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	result := runCfVault(t, envVars, "list")
+	if result.ExitCode == 0 {
+		t.Fatalf("expected non-zero exit for world readable config, got 0\nstdout: %s", result.Stdout)
+	}
+	if !strings.Contains(result.Stderr, "accessible by group or others") {
+		t.Errorf("expected permissions error in stderr, got: %q", result.Stderr)
+	}
+
+	result = runCfVault(t, envVars, "list", "--allow-insecure-permissions")
+	if result.ExitCode != 0 {
+		t.Fatalf("expected exit 0 with --allow-insecure-permissions, got %d\nstderr: %s", result.ExitCode, result.Stderr)
+	}
+}
+
+func TestIntegration_Audit_InsecureLogRejected(t *testing.T) {
+	configDir, keyringDir, envVars, cleanup := setupTestEnv(t)
+	defer cleanup()
+
+	writeConfig(t, configDir, `
+[profiles]
+  [profiles.tokenprofile]
+    auth_type = "api_token"
+`)
+	writeKeyringItem(t, keyringDir, "tokenprofile-api_token", []byte("abcdefghijklmnopqrstuvwxyzABCDEF12345678"))
+
+	filtered := make([]string, 0, len(envVars))
+	for _, e := range envVars {
+		if !strings.HasPrefix(e, "CLOUDFLARE_VAULT_SESSION=") {
+			filtered = append(filtered, e)
+		}
+	}
+
+	if result := runCfVault(t, filtered, "exec", "tokenprofile", "--", "true"); result.ExitCode != 0 {
+		t.Fatalf("expected exit 0, got %d\nstderr: %s", result.ExitCode, result.Stderr)
+	}
+	if err := os.Chmod(filepath.Join(filepath.Dir(keyringDir), "audit.log"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, args := range [][]string{{"audit"}, {"audit", "verify"}} {
+		result := runCfVault(t, filtered, args...)
+		if result.ExitCode == 0 {
+			t.Fatalf("expected %v to fail for a world readable audit log\nstdout: %s", args, result.Stdout)
+		}
+		if !strings.Contains(result.Stderr, "accessible by group or others") {
+			t.Errorf("expected permissions error from %v, got: %q", args, result.Stderr)
+		}
+
+		result = runCfVault(t, filtered, append(args, "--allow-insecure-permissions")...)
+		if result.ExitCode != 0 {
+			t.Errorf("expected %v to succeed with --allow-insecure-permissions, got %d\nstderr: %s", args, result.ExitCode, result.Stderr)
+		}
+	}
+}
+
+func TestIntegration_Doctor_FixPermissions(t *testing.T) {
+	configDir, _, envVars, cleanup := setupTestEnv(t)
+	defer cleanup()
+
+	writeConfig(t, configDir, `
+[profiles]
+  [profiles.myprofile]
+    auth_type = "api_token"
+`)
+	configPath := filepath.Join(configDir, "config.toml")
+	if err := os.Chmod(configPath, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	result := runCfVault(t, envVars, "doctor", "--fix")
+	if result.ExitCode != 0 {
+		t.Fatalf("expected exit 0 after fixing permissions, got %d\nstdout: %s\nstderr: %s", result.ExitCode, result.Stdout, result.Stderr)
+	}
+
+	info, err := os.Stat(configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("expected config file mode 0600 after --fix, got %04o", info.Mode().Perm())
+	}
+
+	result = runCfVault(t, envVars, "list")
+	if result.ExitCode != 0 {
+		t.Fatalf("expected list to succeed after --fix, got %d\nstderr: %s", result.ExitCode, result.Stderr)
+	}
+}
+
+func TestIntegration_Exec_AccessServiceToken(t *testing.T) {
+	configDir, keyringDir, envVars, cleanup := setupTestEnv(t)
+	defer cleanup()
+
+	filtered := make([]string, 0, len(envVars))
+	for _, e := range envVars {
+		if !strings.HasPrefix(e, "CLOUDFLARE_VAULT_SESSION=") {
+			filtered = append(filtered, e)
+		}
+	}
+	envVars = filtered
+
+	writeConfig(t, configDir, `
+[profiles]
+  [profiles.accessprofile]
+    auth_type = "access_service_token"
+`)
+
+	writeKeyringItem(t, keyringDir, "accessprofile-access_service_token",
+		[]byte(`{"client_id":"0123456789abcdef0123456789abcdef.access","client_secret":"s3cr3t"}`))
+
+	result := runCfVault(t, envVars, "exec", "accessprofile", "--", "env")
+
+	if result.ExitCode != 0 {
+		t.Fatalf("expected exit 0, got %d\nstderr: %s", result.ExitCode, result.Stderr)
+	}
+
+	if !strings.Contains(result.Stdout, "CF_ACCESS_CLIENT_ID=0123456789abcdef0123456789abcdef.access") {
+		t.Errorf("expected CF_ACCESS_CLIENT_ID in output, got:\n%s", result.Stdout)
+	}
+	if !strings.Contains(result.Stdout, "CF_ACCESS_CLIENT_SECRET=s3cr3t") {
+		t.Errorf("expected CF_ACCESS_CLIENT_SECRET in output, got:\n%s", result.Stdout)
+	}
+	if strings.Contains(result.Stdout, "CLOUDFLARE_ACCESS_SERVICE_TOKEN=") {
+		t.Errorf("the raw keyring value should not be exported, got:\n%s", result.Stdout)
+	}
+}
+
+// mockTokenServer is a fake Cloudflare API that mints short lived tokens and
+// records the requests it receives.
+type mockTokenServer struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	requests []mockTokenRequest
+	deleted  []string
+}
+
+// mockTokenRequest is a token creation request received by mockTokenServer.
+type mockTokenRequest struct {
+	Path string
+	Body map[string]interface{}
+}
+
+// newMockTokenServer starts a mockTokenServer that responds to user and
+// account token creation requests with the ID "mock-token-id" and value
+// "mock-token-value". Later requests get the value "mock-token-value-<n>".
+func newMockTokenServer(t *testing.T) *mockTokenServer {
+	t.Helper()
+
+	m := &mockTokenServer{}
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodDelete && strings.Contains(r.URL.Path, "/tokens/") {
+			m.mu.Lock()
+			m.deleted = append(m.deleted, r.URL.Path)
+			m.mu.Unlock()
+
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"success":  true,
+				"errors":   []interface{}{},
+				"messages": []interface{}{},
+				"result":   map[string]interface{}{"id": path.Base(r.URL.Path)},
+			})
+			return
+		}
+		if r.Method != http.MethodPost || !strings.HasSuffix(r.URL.Path, "/tokens") {
+			http.NotFound(w, r)
+			return
+		}
+
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+
+		m.mu.Lock()
+		m.requests = append(m.requests, mockTokenRequest{Path: r.URL.Path, Body: body})
+		value := "mock-token-value"
+		if n := len(m.requests); n > 1 {
+			value = fmt.Sprintf("mock-token-value-%d", n)
+		}
+		m.mu.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success":  true,
+			"errors":   []interface{}{},
+			"messages": []interface{}{},
+			"result": map[string]interface{}{
+				"id":         "mock-token-id",
+				"value":      value,
+				"expires_on": body["expires_on"],
+			},
+		})
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/user/tokens", handler)
+	mux.HandleFunc("/user/tokens/", handler)
+	mux.HandleFunc("/accounts/", handler)
+	m.Server = httptest.NewServer(mux)
+	t.Cleanup(m.Close)
+	return m
+}
+
+// Requests returns every token creation request received so far.
+func (m *mockTokenServer) Requests() []mockTokenRequest {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]mockTokenRequest{}, m.requests...)
+}
+
+// Deleted returns the paths of every token deletion request received so far.
+func (m *mockTokenServer) Deleted() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]string{}, m.deleted...)
+}
+
+// shortLivedProfile is a minimal profile configuration that mints short lived
+// tokens, for use with newMockTokenServer.
+const shortLivedProfile = `
+[profiles]
+  [profiles.shortlived]
+    auth_type = "api_token"
+    session_duration = "15m"
+    account_id = "0123456789abcdef0123456789abcdef"
+
+    [[profiles.shortlived.policies]]
+      effect = "allow"
+      [profiles.shortlived.policies.resources]
+        "com.cloudflare.api.account.*" = "*"
+      [[profiles.shortlived.policies.permission_groups]]
+        id = "c8fed203ed3043cba015a93ad1616f1f"
+        name = "Zone Read"
+`
+
+// setupShortLivedTestEnv prepares an environment with shortLivedProfile, its
+// keyring item and a mock API for exec to mint tokens from.
+func setupShortLivedTestEnv(t *testing.T) (configDir string, envVars []string, server *mockTokenServer, cleanup func()) {
+	t.Helper()
+
+	configDir, keyringDir, envVars, cleanup := setupTestEnv(t)
+
+	filtered := make([]string, 0, len(envVars))
+	for _, e := range envVars {
+		if !strings.HasPrefix(e, "CLOUDFLARE_VAULT_SESSION=") {
+			filtered = append(filtered, e)
+		}
+	}
+
+	server = newMockTokenServer(t)
+	envVars = append(filtered, "CLOUDFLARE_BASE_URL="+server.URL)
+
+	writeConfig(t, configDir, shortLivedProfile)
+	writeKeyringItem(t, keyringDir, "shortlived-api_token", []byte("abcdefghijklmnopqrstuvwxyzABCDEF12345678"))
+
+	return configDir, envVars, server, cleanup
+}
+
+func TestIntegration_Exec_ShortLivedToken(t *testing.T) {
+	_, envVars, server, cleanup := setupShortLivedTestEnv(t)
+	defer cleanup()
+
+	result := runCfVault(t, envVars, "exec", "shortlived", "--", "env")
+
+	if result.ExitCode != 0 {
+		t.Fatalf("expected exit 0, got %d\nstderr: %s", result.ExitCode, result.Stderr)
+	}
+	if !strings.Contains(result.Stdout, "CLOUDFLARE_API_TOKEN=mock-token-value") {
+		t.Errorf("expected minted CLOUDFLARE_API_TOKEN in output, got:\n%s", result.Stdout)
+	}
+	if !strings.Contains(result.Stdout, "CLOUDFLARE_SESSION_EXPIRY=") {
+		t.Errorf("expected CLOUDFLARE_SESSION_EXPIRY in output, got:\n%s", result.Stdout)
+	}
+	if strings.Contains(result.Stdout, "AWS_ACCESS_KEY_ID=") {
+		t.Errorf("R2 credentials should only be exported with --r2-credentials, got:\n%s", result.Stdout)
+	}
+	if len(server.Requests()) != 1 {
+		t.Errorf("expected 1 token creation request, got %d", len(server.Requests()))
+	}
+}
+
+func TestIntegration_Exec_TokenName(t *testing.T) {
+	configDir, envVars, server, cleanup := setupShortLivedTestEnv(t)
+	defer cleanup()
+
+	result := runCfVault(t, envVars, "exec", "shortlived", "--", "true")
+	if result.ExitCode != 0 {
+		t.Fatalf("expected exit 0, got %d\nstderr: %s", result.ExitCode, result.Stderr)
+	}
+
+	hostname, _ := os.Hostname()
+	name := fmt.Sprint(server.Requests()[0].Body["name"])
+	if !strings.HasPrefix(name, "cf-vault-shortlived-") || !strings.Contains(name, "@"+hostname+"-") {
+		t.Errorf("expected the default token name to include the profile and host, got %q", name)
+	}
+
+	writeConfig(t, configDir, "token_name_template = \"ci-{profile}\"\n"+shortLivedProfile)
+
+	result = runCfVault(t, envVars, "exec", "shortlived", "--", "true")
+	if result.ExitCode != 0 {
+		t.Fatalf("expected exit 0, got %d\nstderr: %s", result.ExitCode, result.Stderr)
+	}
+	if name := server.Requests()[1].Body["name"]; name != "ci-shortlived" {
+		t.Errorf("expected the token to be named from token_name_template, got %v", name)
+	}
+}
+
+func TestIntegration_Exec_R2Credentials(t *testing.T) {
+	_, envVars, _, cleanup := setupShortLivedTestEnv(t)
+	defer cleanup()
+
+	result := runCfVault(t, envVars, "exec", "--r2-credentials", "shortlived", "--", "env")
+
+	if result.ExitCode != 0 {
+		t.Fatalf("expected exit 0, got %d\nstderr: %s", result.ExitCode, result.Stderr)
+	}
+
+	accessKeyID, secretAccessKey := r2Credentials("mock-token-id", "mock-token-value")
+	for _, want := range []string{
+		"AWS_ACCESS_KEY_ID=" + accessKeyID,
+		"AWS_SECRET_ACCESS_KEY=" + secretAccessKey,
+		"AWS_ENDPOINT_URL_S3=https://0123456789abcdef0123456789abcdef.r2.cloudflarestorage.com",
+	} {
+		if !strings.Contains(result.Stdout, want) {
+			t.Errorf("expected %s in output, got:\n%s", want, result.Stdout)
+		}
+	}
+}
+
+func TestIntegration_Exec_R2CredentialsRequiresShortLivedToken(t *testing.T) {
+	configDir, keyringDir, envVars, cleanup := setupTestEnv(t)
+	defer cleanup()
+
+	writeConfig(t, configDir, `
+[profiles]
+  [profiles.tokenprofile]
+    auth_type = "api_token"
+`)
+	writeKeyringItem(t, keyringDir, "tokenprofile-api_token", []byte("abcdefghijklmnopqrstuvwxyzABCDEF12345678"))
+
+	result := runCfVault(t, envVars, "exec", "--r2-credentials", "tokenprofile", "--", "env")
+
+	if result.ExitCode == 0 {
+		t.Fatalf("expected non-zero exit without session_duration, got 0")
+	}
+	if !strings.Contains(result.Stderr, "requires profile") {
+		t.Errorf("expected --r2-credentials requirement error, got: %q", result.Stderr)
+	}
+}
+
+func TestIntegration_Exec_R2CredentialsRejectsRefresh(t *testing.T) {
+	_, envVars, server, cleanup := setupShortLivedTestEnv(t)
+	defer cleanup()
+
+	result := runCfVault(t, envVars, "exec", "--r2-credentials", "--refresh", "shortlived", "--", "env")
+
+	if result.ExitCode == 0 {
+		t.Fatalf("expected non-zero exit for --r2-credentials with --refresh, got 0")
+	}
+	if !strings.Contains(result.Stderr, "can't be used with --refresh") {
+		t.Errorf("expected --r2-credentials and --refresh to be rejected, got: %q", result.Stderr)
+	}
+	if n := len(server.Requests()); n != 0 {
+		t.Errorf("expected no token to be minted, got %d requests", n)
+	}
+}
+
+func TestIntegration_Exec_OriginCAKey(t *testing.T) {
+	configDir, keyringDir, envVars, cleanup := setupTestEnv(t)
+	defer cleanup()
+
+	filtered := make([]string, 0, len(envVars))
+	for _, e := range envVars {
+		if !strings.HasPrefix(e, "CLOUDFLARE_VAULT_SESSION=") {
+			filtered = append(filtered, e)
+		}
+	}
+	envVars = filtered
+
+	writeConfig(t, configDir, `
+[profiles]
+  [profiles.certs]
+    auth_type = "origin_ca_key"
+`)
+
+	writeKeyringItem(t, keyringDir, "certs-origin_ca_key", []byte("v1.0-0123456789abcdef01234567-0123456789abcdef"))
+
+	result := runCfVault(t, envVars, "exec", "certs", "--", "env")
+
+	if result.ExitCode != 0 {
+		t.Fatalf("expected exit 0, got %d\nstderr: %s", result.ExitCode, result.Stderr)
+	}
+	if !strings.Contains(result.Stdout, "CLOUDFLARE_API_USER_SERVICE_KEY=v1.0-0123456789abcdef01234567-0123456789abcdef") {
+		t.Errorf("expected CLOUDFLARE_API_USER_SERVICE_KEY in output, got:\n%s", result.Stdout)
+	}
+	if !strings.Contains(result.Stdout, "CF_API_USER_SERVICE_KEY=v1.0-0123456789abcdef01234567-0123456789abcdef") {
+		t.Errorf("expected CF_API_USER_SERVICE_KEY in output, got:\n%s", result.Stdout)
+	}
+}
+
+func TestIntegration_Exec_AccountOwnedToken(t *testing.T) {
+	configDir, envVars, server, cleanup := setupShortLivedTestEnv(t)
+	defer cleanup()
+
+	writeConfig(t, configDir, strings.Replace(shortLivedProfile,
+		`session_duration = "15m"`,
+		`session_duration = "15m"
+    token_owner = "account"`, 1))
+
+	result := runCfVault(t, envVars, "exec", "shortlived", "--", "env")
+
+	if result.ExitCode != 0 {
+		t.Fatalf("expected exit 0, got %d\nstderr: %s", result.ExitCode, result.Stderr)
+	}
+	if !strings.Contains(result.Stdout, "CLOUDFLARE_API_TOKEN=mock-token-value") {
+		t.Errorf("expected minted CLOUDFLARE_API_TOKEN in output, got:\n%s", result.Stdout)
+	}
+
+	requests := server.Requests()
+	if len(requests) != 1 {
+		t.Fatalf("expected 1 token creation request, got %d", len(requests))
+	}
+	if want := "/accounts/0123456789abcdef0123456789abcdef/tokens"; requests[0].Path != want {
+		t.Errorf("expected token to be created at %s, got %s", want, requests[0].Path)
+	}
+}
+
+func TestIntegration_Exec_AccountAndZoneIDs(t *testing.T) {
+	configDir, keyringDir, envVars, cleanup := setupTestEnv(t)
+	defer cleanup()
+
+	filtered := make([]string, 0, len(envVars))
+	for _, e := range envVars {
+		if !strings.HasPrefix(e, "CLOUDFLARE_VAULT_SESSION=") {
+			filtered = append(filtered, e)
+		}
+	}
+	envVars = filtered
+
+	writeConfig(t, configDir, `
+[profiles]
+  [profiles.tokenprofile]
+    auth_type = "api_token"
+    account_id = "0123456789abcdef0123456789abcdef"
+    zone_id = "fedcba9876543210fedcba9876543210"
+`)
+	writeKeyringItem(t, keyringDir, "tokenprofile-api_token", []byte("abcdefghijklmnopqrstuvwxyzABCDEF12345678"))
+
+	result := runCfVault(t, envVars, "exec", "tokenprofile", "--", "env")
+
+	if result.ExitCode != 0 {
+		t.Fatalf("expected exit 0, got %d\nstderr: %s", result.ExitCode, result.Stderr)
+	}
+	for _, want := range []string{
+		"CLOUDFLARE_ACCOUNT_ID=0123456789abcdef0123456789abcdef",
+		"CF_ACCOUNT_ID=0123456789abcdef0123456789abcdef",
+		"CLOUDFLARE_ZONE_ID=fedcba9876543210fedcba9876543210",
+		"CF_ZONE_ID=fedcba9876543210fedcba9876543210",
+	} {
+		if !strings.Contains(result.Stdout, want) {
+			t.Errorf("expected %s in output, got:\n%s", want, result.Stdout)
+		}
+	}
+}
+
+func TestIntegration_Exec_EnvMapping(t *testing.T) {
+	configDir, keyringDir, envVars, cleanup := setupTestEnv(t)
+	defer cleanup()
+
+	filtered := make([]string, 0, len(envVars))
+	for _, e := range envVars {
+		if !strings.HasPrefix(e, "CLOUDFLARE_VAULT_SESSION=") {
+			filtered = append(filtered, e)
+		}
+	}
+	envVars = filtered
+
+	writeConfig(t, configDir, `
+[profiles]
+  [profiles.tokenprofile]
+    auth_type = "api_token"
+
+    [profiles.tokenprofile.env]
+      suppress = ["CF_API_TOKEN"]
+
+      [profiles.tokenprofile.env.rename]
+        CLOUDFLARE_API_TOKEN = "TF_VAR_cloudflare_api_token"
+
+      [profiles.tokenprofile.env.extra]
+        TF_VAR_environment = "production"
+`)
+	writeKeyringItem(t, keyringDir, "tokenprofile-api_token", []byte("abcdefghijklmnopqrstuvwxyzABCDEF12345678"))
+
+	result := runCfVault(t, envVars, "exec", "tokenprofile", "--", "env")
+
+	if result.ExitCode != 0 {
+		t.Fatalf("expected exit 0, got %d\nstderr: %s", result.ExitCode, result.Stderr)
+	}
+	if !strings.Contains(result.Stdout, "TF_VAR_cloudflare_api_token=abcdefghijklmnopqrstuvwxyzABCDEF12345678") {
+		t.Errorf("expected renamed token in output, got:\n%s", result.Stdout)
+	}
+	if !strings.Contains(result.Stdout, "TF_VAR_environment=production") {
+		t.Errorf("expected extra variable in output, got:\n%s", result.Stdout)
+	}
+	for _, unwanted := range []string{"\nCLOUDFLARE_API_TOKEN=", "\nCF_API_TOKEN="} {
+		if strings.Contains("\n"+result.Stdout, unwanted) {
+			t.Errorf("expected %s to be absent, got:\n%s", strings.TrimSpace(unwanted), result.Stdout)
+		}
+	}
+	if !strings.Contains(result.Stdout, "CLOUDFLARE_VAULT_SESSION=tokenprofile") {
+		t.Errorf("expected CLOUDFLARE_VAULT_SESSION to be unaffected by the mapping, got:\n%s", result.Stdout)
+	}
+}
+
+func TestIntegration_Exec_SecretsAsFiles(t *testing.T) {
+	configDir, keyringDir, envVars, cleanup := setupTestEnv(t)
+	defer cleanup()
+
+	filtered := make([]string, 0, len(envVars))
+	for _, e := range envVars {
+		if !strings.HasPrefix(e, "CLOUDFLARE_VAULT_SESSION=") {
+			filtered = append(filtered, e)
+		}
+	}
+	envVars = filtered
+
+	writeConfig(t, configDir, `
+[profiles]
+  [profiles.testprofile]
+    email = "user@example.com"
+    auth_type = "api_key"
+`)
+	writeKeyringItem(t, keyringDir, "testprofile-api_key", []byte("a1b2c3d4e5f6a1b2c3d4e5f6a1b2c3d4e5f"))
+
+	result := runCfVault(t, envVars, "exec", "--secrets-as-files", "testprofile", "--",
+		"sh", "-c", `env; echo "secret=$(cat "$CLOUDFLARE_API_KEY_FILE")"`)
+
+	if result.ExitCode != 0 {
+		t.Fatalf("expected exit 0, got %d\nstderr: %s", result.ExitCode, result.Stderr)
+	}
+	if !strings.Contains(result.Stdout, "secret=a1b2c3d4e5f6a1b2c3d4e5f6a1b2c3d4e5f") {
+		t.Errorf("expected the API key to be readable from CLOUDFLARE_API_KEY_FILE, got:\n%s", result.Stdout)
+	}
+	if strings.Contains(result.Stdout, "CLOUDFLARE_API_KEY=") || strings.Contains(result.Stdout, "CF_API_KEY=") {
+		t.Errorf("expected the API key not to be in the environment, got:\n%s", result.Stdout)
+	}
+	if !strings.Contains(result.Stdout, "CLOUDFLARE_EMAIL=user@example.com") {
+		t.Errorf("expected non-secret CLOUDFLARE_EMAIL to remain a variable, got:\n%s", result.Stdout)
+	}
+
+	var secretPath string
+	for _, line := range strings.Split(result.Stdout, "\n") {
+		if strings.HasPrefix(line, "CLOUDFLARE_API_KEY_FILE=") {
+			secretPath = strings.TrimPrefix(line, "CLOUDFLARE_API_KEY_FILE=")
+		}
+	}
+	if secretPath == "" {
+		t.Fatalf("expected CLOUDFLARE_API_KEY_FILE in output, got:\n%s", result.Stdout)
+	}
+	if _, err := os.Stat(filepath.Dir(secretPath)); !os.IsNotExist(err) {
+		t.Errorf("expected secrets directory %s to be removed after exit, got err=%v", filepath.Dir(secretPath), err)
+	}
+}
+
+func TestIntegration_Exec_SecretsAsFilesExitCode(t *testing.T) {
+	configDir, keyringDir, envVars, cleanup := setupTestEnv(t)
+	defer cleanup()
+
+	filtered := make([]string, 0, len(envVars))
+	for _, e := range envVars {
+		if !strings.HasPrefix(e, "CLOUDFLARE_VAULT_SESSION=") {
+			filtered = append(filtered, e)
+		}
+	}
+	envVars = filtered
+
+	writeConfig(t, configDir, `
+[profiles]
+  [profiles.tokenprofile]
+    auth_type = "api_token"
+`)
+	writeKeyringItem(t, keyringDir, "tokenprofile-api_token", []byte("abcdefghijklmnopqrstuvwxyzABCDEF12345678"))
+
+	result := runCfVault(t, envVars, "exec", "--secrets-as-files", "tokenprofile", "--", "sh", "-c", "exit 3")
+
+	if result.ExitCode != 3 {
+		t.Errorf("expected the child's exit code 3, got %d\nstderr: %s", result.ExitCode, result.Stderr)
+	}
+}
+
+func TestIntegration_Exec_Refresh(t *testing.T) {
+	_, envVars, server, cleanup := setupShortLivedTestEnv(t)
+	defer cleanup()
+
+	// The profile's session is 15m so the token is refreshed after ~2s.
+	result := runCfVault(t, envVars, "exec", "--refresh", "--refresh-before", "14m58s", "shortlived", "--",
+		"sh", "-c", `echo "before=$(cat "$CLOUDFLARE_VAULT_TOKEN_FILE")"; sleep 4; echo "after=$(cat "$CLOUDFLARE_VAULT_TOKEN_FILE")"`)
+
+	if result.ExitCode != 0 {
+		t.Fatalf("expected exit 0, got %d\nstderr: %s", result.ExitCode, result.Stderr)
+	}
+	if !strings.Contains(result.Stdout, "before=mock-token-value\n") {
+		t.Errorf("expected the initial token in the token file, got:\n%s", result.Stdout)
+	}
+	if !strings.Contains(result.Stdout, "after=mock-token-value-") {
+		t.Errorf("expected the refreshed token in the token file, got:\n%s", result.Stdout)
+	}
+	if !strings.Contains(result.Stderr, "refreshed the short lived token") {
+		t.Errorf("expected a refresh notice, got:\n%s", result.Stderr)
+	}
+	if n := len(server.Requests()); n < 2 {
+		t.Errorf("expected at least 2 token requests, got %d", n)
+	}
+}
+
+func TestIntegration_Exec_RefreshRequiresSessionDuration(t *testing.T) {
+	configDir, keyringDir, envVars, cleanup := setupTestEnv(t)
+	defer cleanup()
+
+	writeConfig(t, configDir, `
+[profiles]
+  [profiles.tokenprofile]
+    auth_type = "api_token"
+`)
+	writeKeyringItem(t, keyringDir, "tokenprofile-api_token", []byte("abcdefghijklmnopqrstuvwxyzABCDEF12345678"))
+
+	filtered := make([]string, 0, len(envVars))
+	for _, e := range envVars {
+		if !strings.HasPrefix(e, "CLOUDFLARE_VAULT_SESSION=") {
+			filtered = append(filtered, e)
+		}
+	}
+
+	result := runCfVault(t, filtered, "exec", "--refresh", "tokenprofile", "--", "true")
+
+	if result.ExitCode == 0 {
+		t.Fatal("expected non-zero exit without session_duration")
+	}
+	if !strings.Contains(result.Stderr, "requires profile") {
+		t.Errorf("expected session_duration error, got:\n%s", result.Stderr)
+	}
+}
+
+func TestIntegration_Exec_DurationClampedToMax(t *testing.T) {
+	configDir, envVars, server, cleanup := setupShortLivedTestEnv(t)
+	defer cleanup()
+
+	writeConfig(t, configDir, "max_session_duration = \"1h\"\n"+shortLivedProfile)
+
+	start := time.Now()
+	result := runCfVault(t, envVars, "exec", "--duration", "2h", "shortlived", "--", "true")
+
+	if result.ExitCode != 0 {
+		t.Fatalf("expected exit 0, got %d\nstderr: %s", result.ExitCode, result.Stderr)
+	}
+	if !strings.Contains(result.Stderr, "longer than the max_session_duration") {
+		t.Errorf("expected a warning about clamping --duration, got:\n%s", result.Stderr)
+	}
+
+	requests := server.Requests()
+	if len(requests) != 1 {
+		t.Fatalf("expected 1 token creation request, got %d", len(requests))
+	}
+	expiresOn, err := time.Parse(time.RFC3339, fmt.Sprint(requests[0].Body["expires_on"]))
+	if err != nil {
+		t.Fatalf("unable to parse expires_on: %s", err)
+	}
+	if d := expiresOn.Sub(start); d < 59*time.Minute || d > 61*time.Minute {
+		t.Errorf("expected the token to expire in ~1h, got %s", d)
+	}
+}
+
+func TestIntegration_Exec_SessionDurationRejected(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+		args   []string
+		want   string
+	}{
+		{"duration too short", shortLivedProfile, []string{"--duration", "10s"}, "too short"},
+		{"beyond global maximum", "max_session_duration = \"5m\"\n" + shortLivedProfile, nil, "longer than the max_session_duration"},
+		{"beyond limit", strings.Replace(shortLivedProfile, `"15m"`, `"9000h"`, 1), nil, "too long"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configDir, envVars, server, cleanup := setupShortLivedTestEnv(t)
+			defer cleanup()
+
+			writeConfig(t, configDir, tt.config)
+
+			args := append([]string{"exec"}, tt.args...)
+			result := runCfVault(t, envVars, append(args, "shortlived", "--", "true")...)
+
+			if result.ExitCode == 0 {
+				t.Fatal("expected non-zero exit")
+			}
+			if !strings.Contains(result.Stderr, tt.want) {
+				t.Errorf("expected error containing %q, got:\n%s", tt.want, result.Stderr)
+			}
+			if n := len(server.Requests()); n != 0 {
+				t.Errorf("expected no token to be minted, got %d requests", n)
+			}
+		})
+	}
+}
+
+func TestIntegration_Status(t *testing.T) {
+	configDir, _, envVars, cleanup := setupTestEnv(t)
+	defer cleanup()
+
+	writeConfig(t, configDir, shortLivedProfile)
+
+	filtered := make([]string, 0, len(envVars))
+	for _, e := range envVars {
+		if !strings.HasPrefix(e, "CLOUDFLARE_VAULT_SESSION=") {
+			filtered = append(filtered, e)
+		}
+	}
+
+	t.Run("outside a session", func(t *testing.T) {
+		result := runCfVault(t, filtered, "status")
+		if result.ExitCode == 0 {
+			t.Fatal("expected non-zero exit outside a session")
+		}
+		if !strings.Contains(result.Stderr, "not in a cf-vault session") {
+			t.Errorf("expected not in a session error, got:\n%s", result.Stderr)
+		}
+	})
+
+	t.Run("active session", func(t *testing.T) {
+		expiry := strconv.FormatInt(time.Now().Add(10*time.Minute).Unix(), 10)
+		result := runCfVault(t, append(filtered, "CLOUDFLARE_VAULT_SESSION=shortlived", "CLOUDFLARE_SESSION_EXPIRY="+expiry), "status")
+		if result.ExitCode != 0 {
+			t.Fatalf("expected exit 0, got %d\nstderr: %s", result.ExitCode, result.Stderr)
+		}
+		for _, want := range []string{"shortlived", "api_token", "(in ", "allow Zone Read on com.cloudflare.api.account.*"} {
+			if !strings.Contains(result.Stdout, want) {
+				t.Errorf("expected %q in output, got:\n%s", want, result.Stdout)
+			}
+		}
+	})
+
+	t.Run("json output", func(t *testing.T) {
+		expiry := strconv.FormatInt(time.Now().Add(10*time.Minute).Unix(), 10)
+		result := runCfVault(t, append(filtered, "CLOUDFLARE_VAULT_SESSION=shortlived", "CLOUDFLARE_SESSION_EXPIRY="+expiry), "status", "--output", "json")
+		if result.ExitCode != 0 {
+			t.Fatalf("expected exit 0, got %d\nstderr: %s", result.ExitCode, result.Stderr)
+		}
+
+		var status sessionStatus
+		if err := json.Unmarshal([]byte(result.Stdout), &status); err != nil {
+			t.Fatalf("expected JSON output, got error %v\nstdout: %s", err, result.Stdout)
+		}
+		if status.Profile != "shortlived" || status.Expired || status.ExpiresAt.IsZero() {
+			t.Errorf("unexpected status: %+v", status)
+		}
+	})
+
+	t.Run("json output with static credentials", func(t *testing.T) {
+		result := runCfVault(t, append(filtered, "CLOUDFLARE_VAULT_SESSION=shortlived"), "status", "--output", "json")
+		if result.ExitCode != 0 {
+			t.Fatalf("expected exit 0, got %d\nstderr: %s", result.ExitCode, result.Stderr)
+		}
+		if strings.Contains(result.Stdout, "expires_at") {
+			t.Errorf("expected no expiry for static credentials, got:\n%s", result.Stdout)
+		}
+	})
+
+	t.Run("expired session", func(t *testing.T) {
+		expiry := strconv.FormatInt(time.Now().Add(-time.Minute).Unix(), 10)
+		result := runCfVault(t, append(filtered, "CLOUDFLARE_VAULT_SESSION=shortlived", "CLOUDFLARE_SESSION_EXPIRY="+expiry), "status")
+		if result.ExitCode == 0 {
+			t.Fatal("expected non-zero exit for an expired session")
+		}
+		if !strings.Contains(result.Stdout, "expired") {
+			t.Errorf("expected the session to be reported as expired, got:\n%s", result.Stdout)
+		}
+	})
+}
+
+func TestIntegration_StatusVerify(t *testing.T) {
+	configDir, _, envVars, cleanup := setupTestEnv(t)
+	defer cleanup()
+
+	writeConfig(t, configDir, shortLivedProfile)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/user/tokens/verify" {
+			http.NotFound(w, r)
+			return
+		}
+		status := "active"
+		if r.Header.Get("Authorization") != "Bearer mock-token-value" {
+			status = "disabled"
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success":  true,
+			"errors":   []interface{}{},
+			"messages": []interface{}{},
+			"result":   map[string]interface{}{"id": "mock-token-id", "status": status},
+		})
+	}))
+	defer server.Close()
+
+	filtered := make([]string, 0, len(envVars))
+	for _, e := range envVars {
+		if !strings.HasPrefix(e, "CLOUDFLARE_VAULT_SESSION=") {
+			filtered = append(filtered, e)
+		}
+	}
+	expiry := strconv.FormatInt(time.Now().Add(10*time.Minute).Unix(), 10)
+	session := append(filtered,
+		"CLOUDFLARE_BASE_URL="+server.URL,
+		"CLOUDFLARE_VAULT_SESSION=shortlived",
+		"CLOUDFLARE_SESSION_EXPIRY="+expiry,
+	)
+
+	result := runCfVault(t, append(session, "CLOUDFLARE_API_TOKEN=mock-token-value"), "status", "--verify")
+	if result.ExitCode != 0 {
+		t.Fatalf("expected exit 0, got %d\nstdout: %s\nstderr: %s", result.ExitCode, result.Stdout, result.Stderr)
+	}
+	if !strings.Contains(result.Stdout, "Token:       active") {
+		t.Errorf("expected an active token, got:\n%s", result.Stdout)
+	}
+
+	result = runCfVault(t, append(session, "CLOUDFLARE_API_TOKEN=revoked"), "status", "--verify")
+	if result.ExitCode == 0 {
+		t.Fatalf("expected non-zero exit for an inactive token\nstdout: %s", result.Stdout)
+	}
+}
+
+func TestIntegration_Prompt(t *testing.T) {
+	_, _, envVars, cleanup := setupTestEnv(t)
+	defer cleanup()
+
+	filtered := make([]string, 0, len(envVars))
+	for _, e := range envVars {
+		if !strings.HasPrefix(e, "CLOUDFLARE_VAULT_SESSION=") {
+			filtered = append(filtered, e)
+		}
+	}
+
+	result := runCfVault(t, filtered, "prompt")
+	if result.ExitCode != 0 || result.Stdout != "" {
+		t.Errorf("expected no output outside a session, got exit %d and %q", result.ExitCode, result.Stdout)
+	}
+
+	expiry := strconv.FormatInt(time.Now().Add(30*time.Minute+30*time.Second).Unix(), 10)
+	result = runCfVault(t, append(filtered, "CLOUDFLARE_VAULT_SESSION=work", "CLOUDFLARE_SESSION_EXPIRY="+expiry), "prompt", "--no-color")
+	if result.ExitCode != 0 {
+		t.Fatalf("expected exit 0, got %d\nstderr: %s", result.ExitCode, result.Stderr)
+	}
+	if result.Stdout != "[work 30m] " {
+		t.Errorf("unexpected prompt %q", result.Stdout)
+	}
+
+	for _, shell := range []string{"bash", "zsh", "fish"} {
+		result = runCfVault(t, filtered, "prompt", "--init", shell)
+		if result.ExitCode != 0 || !strings.Contains(result.Stdout, "cf-vault prompt --shell "+shell) {
+			t.Errorf("expected a %s snippet, got exit %d and:\n%s", shell, result.ExitCode, result.Stdout)
+		}
+	}
+}
+
+func TestIntegration_Exec_NestedSessionPolicy(t *testing.T) {
+	configDir, keyringDir, envVars, cleanup := setupTestEnv(t)
+	defer cleanup()
+
+	writeConfig(t, configDir, `
+nested_sessions = "replace"
+
+[profiles]
+  [profiles.read]
+    auth_type = "api_token"
+  [profiles.same]
+    auth_type = "api_token"
+    nested_sessions = "allow-same-profile"
+`)
+	writeKeyringItem(t, keyringDir, "read-api_token", []byte("abcdefghijklmnopqrstuvwxyzABCDEF12345678"))
+	writeKeyringItem(t, keyringDir, "same-api_token", []byte("abcdefghijklmnopqrstuvwxyzABCDEF12345678"))
+
+	nested := append(envVars,
+		"CLOUDFLARE_VAULT_SESSION=write",
+		"CLOUDFLARE_SESSION_EXPIRY=1700000000",
+		"CF_ZONE_ID=stale",
+	)
+
+	t.Run("replace", func(t *testing.T) {
+		result := runCfVault(t, nested, "exec", "read", "--", "env")
+		if result.ExitCode != 0 {
+			t.Fatalf("expected exit 0, got %d\nstderr: %s", result.ExitCode, result.Stderr)
+		}
+		if !strings.Contains(result.Stdout, "CLOUDFLARE_VAULT_SESSION=read") {
+			t.Errorf("expected the new session, got:\n%s", result.Stdout)
+		}
+		for _, stale := range []string{"CLOUDFLARE_SESSION_EXPIRY=", "CF_ZONE_ID="} {
+			if strings.Contains(result.Stdout, stale) {
+				t.Errorf("expected %s from the outer session to be cleared, got:\n%s", stale, result.Stdout)
+			}
+		}
+		if !strings.Contains(result.Stderr, `nested_sessions = \"replace\"`) {
+			t.Errorf("expected the nested session behaviour to be logged, got:\n%s", result.Stderr)
+		}
+	})
+
+	t.Run("allow same profile", func(t *testing.T) {
+		result := runCfVault(t, append(nested, "CLOUDFLARE_VAULT_SESSION=same", "CLOUDFLARE_VAULT_TOKEN_FILE=/tmp/stale"), "exec", "same", "--", "env")
+		if result.ExitCode != 0 {
+			t.Fatalf("expected exit 0, got %d\nstderr: %s", result.ExitCode, result.Stderr)
+		}
+		for _, stale := range []string{"CLOUDFLARE_SESSION_EXPIRY=", "CLOUDFLARE_VAULT_TOKEN_FILE=", "CF_ZONE_ID="} {
+			if strings.Contains(result.Stdout, stale) {
+				t.Errorf("expected %s from the outer session to be cleared, got:\n%s", stale, result.Stdout)
+			}
+		}
+
+		result = runCfVault(t, nested, "exec", "same", "--", "true")
+		if result.ExitCode == 0 {
+			t.Fatal("expected a different profile to be refused")
+		}
+		if !strings.Contains(result.Stderr, "shouldn't be nested") {
+			t.Errorf("expected nesting error message, got:\n%s", result.Stderr)
+		}
+	})
+}
+
+func TestIntegration_Exec_ScrubsInheritedCredentials(t *testing.T) {
+	configDir, keyringDir, envVars, cleanup := setupTestEnv(t)
+	defer cleanup()
+
+	writeConfig(t, configDir, `
+[profiles]
+  [profiles.tokenprofile]
+    auth_type = "api_token"
+
+    [profiles.tokenprofile.env]
+      allowlist = ["CF_EMAIL"]
+`)
+	writeKeyringItem(t, keyringDir, "tokenprofile-api_token", []byte("abcdefghijklmnopqrstuvwxyzABCDEF12345678"))
+
+	filtered := make([]string, 0, len(envVars))
+	for _, e := range envVars {
+		if !strings.HasPrefix(e, "CLOUDFLARE_VAULT_SESSION=") {
+			filtered = append(filtered, e)
+		}
+	}
+	filtered = append(filtered,
+		"CLOUDFLARE_API_KEY=stray",
+		"CF_API_KEY=stray",
+		"CF_EMAIL=kept@example.com",
+		"UNRELATED_VAR=1",
+	)
+
+	result := runCfVault(t, filtered, "exec", "tokenprofile", "--", "env")
+	if result.ExitCode != 0 {
+		t.Fatalf("expected exit 0, got %d\nstderr: %s", result.ExitCode, result.Stderr)
+	}
+	if strings.Contains(result.Stdout, "API_KEY=stray") {
+		t.Errorf("expected inherited API keys to be removed, got:\n%s", result.Stdout)
+	}
+	for _, want := range []string{"CF_EMAIL=kept@example.com", "UNRELATED_VAR=1", "CLOUDFLARE_API_TOKEN="} {
+		if !strings.Contains(result.Stdout, want) {
+			t.Errorf("expected %s in output, got:\n%s", want, result.Stdout)
+		}
+	}
+
+	result = runCfVault(t, filtered, "exec", "--clean-env", "tokenprofile", "--", "env")
+	if result.ExitCode != 0 {
+		t.Fatalf("expected exit 0, got %d\nstderr: %s", result.ExitCode, result.Stderr)
+	}
+	if strings.Contains(result.Stdout, "UNRELATED_VAR=") {
+		t.Errorf("expected --clean-env to drop unrelated variables, got:\n%s", result.Stdout)
+	}
+	for _, want := range []string{"CF_EMAIL=kept@example.com", "CLOUDFLARE_API_TOKEN=", "CLOUDFLARE_VAULT_SESSION=tokenprofile"} {
+		if !strings.Contains(result.Stdout, want) {
+			t.Errorf("expected %s in output, got:\n%s", want, result.Stdout)
+		}
+	}
+}
+
+func TestIntegration_Exec_Hooks(t *testing.T) {
+	configDir, envVars, _, cleanup := setupShortLivedTestEnv(t)
+	defer cleanup()
+
+	hookOutput := filepath.Join(t.TempDir(), "hooks.log")
+	writeConfig(t, configDir, shortLivedProfile+`
+      [profiles.shortlived.hooks]
+        pre_exec = ['echo "pre $CLOUDFLARE_VAULT_SESSION $CLOUDFLARE_VAULT_TOKEN_ID $CLOUDFLARE_SESSION_EXPIRY token=$CLOUDFLARE_API_TOKEN" >> "$HOOK_OUTPUT"']
+        post_exec = ['echo "post $CLOUDFLARE_VAULT_EXIT_CODE" >> "$HOOK_OUTPUT"']
+`)
+	envVars = append(envVars, "HOOK_OUTPUT="+hookOutput)
+
+	result := runCfVault(t, envVars, "exec", "shortlived", "--", "sh", "-c", "exit 4")
+	if result.ExitCode != 4 {
+		t.Fatalf("expected the child's exit code 4, got %d\nstderr: %s", result.ExitCode, result.Stderr)
+	}
+
+	data, err := os.ReadFile(hookOutput)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected both hooks to run, got:\n%s", data)
+	}
+	if !strings.HasPrefix(lines[0], "pre shortlived mock-token-id 1") || !strings.HasSuffix(lines[0], "token=") {
+		t.Errorf("expected the pre_exec hook to get the session but not the token, got %q", lines[0])
+	}
+	if lines[1] != "post 4" {
+		t.Errorf("expected the post_exec hook to get the exit code, got %q", lines[1])
+	}
+}
+
+func TestIntegration_Exec_HooksWithRefresh(t *testing.T) {
+	configDir, envVars, _, cleanup := setupShortLivedTestEnv(t)
+	defer cleanup()
+
+	hookOutput := filepath.Join(t.TempDir(), "hooks.log")
+	writeConfig(t, configDir, shortLivedProfile+`
+      [profiles.shortlived.hooks]
+        pre_exec = ['echo "token_file=$CLOUDFLARE_VAULT_TOKEN_FILE expiry_file=$CLOUDFLARE_VAULT_EXPIRY_FILE" >> "$HOOK_OUTPUT"']
+`)
+	envVars = append(envVars, "HOOK_OUTPUT="+hookOutput)
+
+	result := runCfVault(t, envVars, "exec", "--refresh", "shortlived", "--", "true")
+	if result.ExitCode != 0 {
+		t.Fatalf("expected exit 0, got %d\nstderr: %s", result.ExitCode, result.Stderr)
+	}
+
+	data, err := os.ReadFile(hookOutput)
+	if err != nil {
+		t.Fatal(err)
+	}
+	line := strings.TrimSpace(string(data))
+	if !strings.HasPrefix(line, "token_file= ") || strings.HasSuffix(line, "expiry_file=") {
+		t.Errorf("expected the hook to get the expiry file but not the token file, got %q", line)
+	}
+}
+
+func TestIntegration_Exec_CommandFailsToStart(t *testing.T) {
+	_, envVars, server, cleanup := setupShortLivedTestEnv(t)
+	defer cleanup()
+
+	// An executable file without a shebang can't be started.
+	script := filepath.Join(t.TempDir(), "no-shebang")
+	if err := os.WriteFile(script, []byte("echo ran\n"), 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	result := runCfVault(t, envVars, "exec", "shortlived", "--", script)
+	if result.ExitCode == 0 {
+		t.Fatal("expected non-zero exit when the command can't be started")
+	}
+	if !strings.Contains(result.Stderr, "failed to run") {
+		t.Errorf("expected the start failure in the error, got:\n%s", result.Stderr)
+	}
+	if deleted := server.Deleted(); len(deleted) != 1 || deleted[0] != "/user/tokens/mock-token-id" {
+		t.Errorf("expected the minted token to be deleted, got deletions: %v", deleted)
+	}
+
+	result = runCfVault(t, envVars, "audit", "--output", "json", "--event", "exec")
+	var records []auditRecord
+	if err := json.Unmarshal([]byte(result.Stdout), &records); err != nil {
+		t.Fatalf("expected JSON output, got error %v\nstdout: %s", err, result.Stdout)
+	}
+	if len(records) != 1 || records[0].ExitCode != nil || !strings.Contains(records[0].Error, "failed to run") {
+		t.Errorf("expected an exec record with the start failure and no exit code, got %+v", records)
+	}
+}
+
+func TestIntegration_Exec_FailingPreExecHook(t *testing.T) {
+	configDir, envVars, server, cleanup := setupShortLivedTestEnv(t)
+	defer cleanup()
+
+	marker := filepath.Join(t.TempDir(), "ran")
+	writeConfig(t, configDir, shortLivedProfile+`
+      [profiles.shortlived.hooks]
+        pre_exec = ["exit 1"]
+`)
+
+	result := runCfVault(t, envVars, "exec", "shortlived", "--", "touch", marker)
+	if result.ExitCode == 0 {
+		t.Fatal("expected non-zero exit when a pre_exec hook fails")
+	}
+	if !strings.Contains(result.Stderr, "pre_exec hook") {
+		t.Errorf("expected the failing hook in the error, got:\n%s", result.Stderr)
+	}
+	if _, err := os.Stat(marker); !os.IsNotExist(err) {
+		t.Error("expected the command not to run")
+	}
+	if deleted := server.Deleted(); len(deleted) != 1 || deleted[0] != "/user/tokens/mock-token-id" {
+		t.Errorf("expected the minted token to be deleted, got deletions: %v", deleted)
+	}
+}
+
+func TestIntegration_Exec_RequireConfirmation(t *testing.T) {
+	configDir, keyringDir, envVars, cleanup := setupTestEnv(t)
+	defer cleanup()
+
+	writeConfig(t, configDir, `
+[profiles]
+  [profiles.production]
+    auth_type = "api_token"
+    require_confirmation = true
+`)
+	writeKeyringItem(t, keyringDir, "production-api_token", []byte("abcdefghijklmnopqrstuvwxyzABCDEF12345678"))
+
+	filtered := make([]string, 0, len(envVars))
+	for _, e := range envVars {
+		if !strings.HasPrefix(e, "CLOUDFLARE_VAULT_SESSION=") {
+			filtered = append(filtered, e)
+		}
+	}
+
+	result := runCfVault(t, filtered, "exec", "production", "--", "true")
+	if result.ExitCode == 0 {
+		t.Fatal("expected non-interactive use without --yes to fail")
+	}
+	if !strings.Contains(result.Stderr, "requires confirmation") {
+		t.Errorf("expected confirmation error, got:\n%s", result.Stderr)
+	}
+
+	result = runCfVault(t, filtered, "exec", "--yes", "production", "--", "true")
+	if result.ExitCode != 0 {
+		t.Errorf("expected --yes to confirm, got exit %d\nstderr: %s", result.ExitCode, result.Stderr)
+	}
+}
+
+func TestIntegration_Exec_TOTP(t *testing.T) {
+	configDir, keyringDir, envVars, cleanup := setupTestEnv(t)
+	defer cleanup()
+
+	writeConfig(t, configDir, `
+[profiles]
+  [profiles.totpprofile]
+    auth_type = "api_token"
+    totp = true
+`)
+	writeKeyringItem(t, keyringDir, "totpprofile-api_token", []byte("abcdefghijklmnopqrstuvwxyzABCDEF12345678"))
+	secret := "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+	writeKeyringItem(t, keyringDir, "totpprofile-totp", []byte(secret))
+
+	filtered := make([]string, 0, len(envVars))
+	for _, e := range envVars {
+		if !strings.HasPrefix(e, "CLOUDFLARE_VAULT_SESSION=") {
+			filtered = append(filtered, e)
+		}
+	}
+
+	result := runCfVault(t, filtered, "exec", "totpprofile", "--", "true")
+	if result.ExitCode == 0 || !strings.Contains(result.Stderr, "requires a TOTP code") {
+		t.Errorf("expected a missing code to be refused, got exit %d\nstderr: %s", result.ExitCode, result.Stderr)
+	}
+
+	result = runCfVault(t, filtered, "exec", "--totp-code", "000000", "totpprofile", "--", "true")
+	if result.ExitCode == 0 || !strings.Contains(result.Stderr, "invalid TOTP code") {
+		t.Errorf("expected an invalid code to be refused, got exit %d\nstderr: %s", result.ExitCode, result.Stderr)
+	}
+
+	code, err := totpCode(secret, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	result = runCfVault(t, filtered, "exec", "--totp-code", code, "totpprofile", "--", "env")
+	if result.ExitCode != 0 {
+		t.Fatalf("expected a valid code to be accepted, got exit %d\nstderr: %s", result.ExitCode, result.Stderr)
+	}
+	if !strings.Contains(result.Stdout, "CLOUDFLARE_API_TOKEN=") {
+		t.Errorf("expected the credential to be released, got:\n%s", result.Stdout)
+	}
+}
+
+func TestIntegration_AuditLog(t *testing.T) {
+	_, envVars, _, cleanup := setupShortLivedTestEnv(t)
+	defer cleanup()
+
+	result := runCfVault(t, envVars, "exec", "shortlived", "--", "sh", "-c", `echo "$CLOUDFLARE_API_TOKEN" > /dev/null; exit 2`)
+	if result.ExitCode != 2 {
+		t.Fatalf("expected exit 2, got %d\nstderr: %s", result.ExitCode, result.Stderr)
+	}
+
+	result = runCfVault(t, envVars, "audit", "--output", "json", "--profile", "shortlived")
+	if result.ExitCode != 0 {
+		t.Fatalf("expected exit 0, got %d\nstderr: %s", result.ExitCode, result.Stderr)
+	}
+
+	var records []auditRecord
+	if err := json.Unmarshal([]byte(result.Stdout), &records); err != nil {
+		t.Fatalf("expected JSON output, got error %v\nstdout: %s", err, result.Stdout)
+	}
+
+	if len(records) != 2 {
+		t.Fatalf("expected a token_mint and an exec record, got:\n%s", result.Stdout)
+	}
+	if records[0].Event != auditEventTokenMint || records[0].TokenID != "mock-token-id" || records[0].TokenExpiresOn == nil {
+		t.Errorf("unexpected token_mint record %+v", records[0])
+	}
+	if records[1].Event != auditEventExec || records[1].ExitCode == nil || *records[1].ExitCode != 2 {
+		t.Errorf("unexpected exec record %+v", records[1])
+	}
+	if records[1].User == "" || len(records[1].Command) == 0 {
+		t.Errorf("expected the user and command line to be recorded, got %+v", records[1])
+	}
+	if strings.Contains(result.Stdout, "mock-token-value") {
+		t.Errorf("expected no secrets in the audit log, got:\n%s", result.Stdout)
+	}
+
+	result = runCfVault(t, envVars, "audit", "--event", "exec")
+	if result.ExitCode != 0 || !strings.Contains(result.Stdout, "shortlived") || strings.Contains(result.Stdout, "token_mint") {
+		t.Errorf("expected only the exec record in the table, got exit %d:\n%s", result.ExitCode, result.Stdout)
+	}
+
+	result = runCfVault(t, envVars, "audit", "-o", "yaml", "--event", "token_mint")
+	if result.ExitCode != 0 {
+		t.Fatalf("expected exit 0, got %d\nstderr: %s", result.ExitCode, result.Stderr)
+	}
+	if !strings.HasPrefix(result.Stdout, "- timestamp: ") || !strings.Contains(result.Stdout, "  token_id: mock-token-id\n") {
+		t.Errorf("unexpected YAML output:\n%s", result.Stdout)
+	}
+}
+
+func TestIntegration_AuditLog_RefusedSessions(t *testing.T) {
+	configDir, keyringDir, envVars, cleanup := setupTestEnv(t)
+	defer cleanup()
+
+	closed := time.Now().UTC().Add(12 * time.Hour)
+	writeConfig(t, configDir, fmt.Sprintf(`
+[profiles]
+  [profiles.tokenprofile]
+    auth_type = "api_token"
+
+  [profiles.totpprofile]
+    auth_type = "api_token"
+    totp = true
+
+  [profiles.confirmprofile]
+    auth_type = "api_token"
+    require_confirmation = true
+
+  [profiles.windowprofile]
+    auth_type = "api_token"
+    [profiles.windowprofile.allowed_window]
+      start = "%s"
+      end = "%s"
+      timezone = "UTC"
+
+  [profiles.hookprofile]
+    auth_type = "api_token"
+    [profiles.hookprofile.hooks]
+      pre_exec = ["exit 1"]
+
+  [profiles.missingprofile]
+    auth_type = "api_token"
+`, closed.Format("15:04"), closed.Add(time.Minute).Format("15:04")))
+	for _, name := range []string{"tokenprofile", "totpprofile", "confirmprofile", "windowprofile", "hookprofile"} {
+		writeKeyringItem(t, keyringDir, name+"-api_token", []byte("abcdefghijklmnopqrstuvwxyzABCDEF12345678"))
+	}
+	writeKeyringItem(t, keyringDir, "totpprofile-totp", []byte("GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"))
+
+	filtered := make([]string, 0, len(envVars))
+	for _, e := range envVars {
+		if !strings.HasPrefix(e, "CLOUDFLARE_VAULT_SESSION=") {
+			filtered = append(filtered, e)
+		}
+	}
+
+	refused := map[string][]string{
+		"windowprofile":  {"exec", "windowprofile", "--", "true"},
+		"confirmprofile": {"exec", "confirmprofile", "--", "true"},
+		"totpprofile":    {"exec", "--totp-code", "000000", "totpprofile", "--", "true"},
+		"hookprofile":    {"exec", "hookprofile", "--", "true"},
+		"tokenprofile":   {"exec", "tokenprofile", "--", "cf-vault-no-such-executable"},
+		"missingprofile": {"exec", "missingprofile", "--", "true"},
+	}
+	for _, args := range refused {
+		if result := runCfVault(t, filtered, args...); result.ExitCode == 0 {
+			t.Fatalf("expected %v to fail", args)
+		}
+	}
+
+	result := runCfVault(t, filtered, "audit", "--output", "json", "--event", "exec")
+	if result.ExitCode != 0 {
+		t.Fatalf("expected exit 0, got %d\nstderr: %s", result.ExitCode, result.Stderr)
+	}
+	var records []auditRecord
+	if err := json.Unmarshal([]byte(result.Stdout), &records); err != nil {
+		t.Fatalf("expected JSON output, got error %v\nstdout: %s", err, result.Stdout)
+	}
+	errs := map[string]string{}
+	for _, r := range records {
+		if r.ExitCode != nil {
+			t.Errorf("expected no exit code for a refused session, got %+v", r)
+		}
+		errs[r.Profile] = r.Error
+	}
+	want := map[string]string{
+		"windowprofile":  "may only be used",
+		"confirmprofile": "requires confirmation",
+		"totpprofile":    "invalid TOTP code",
+		"hookprofile":    "pre_exec hook",
+		"tokenprofile":   "couldn't find the executable",
+		"missingprofile": "failed to get item from keyring",
+	}
+	for profile, msg := range want {
+		if !strings.Contains(errs[profile], msg) {
+			t.Errorf("expected the %s exec record to have an error containing %q, got %q", profile, msg, errs[profile])
+		}
+	}
+}
+
+func TestIntegration_AuditLog_RefusedSessionHMAC(t *testing.T) {
+	configDir, keyringDir, envVars, cleanup := setupTestEnv(t)
+	defer cleanup()
+
+	writeConfig(t, configDir, `
+audit_hmac = true
+
+[profiles]
+  [profiles.tokenprofile]
+    auth_type = "api_token"
+
+  [profiles.confirmprofile]
+    auth_type = "api_token"
+    require_confirmation = true
+`)
+	writeKeyringItem(t, keyringDir, "tokenprofile-api_token", []byte("abcdefghijklmnopqrstuvwxyzABCDEF12345678"))
+	writeKeyringItem(t, keyringDir, "confirmprofile-api_token", []byte("abcdefghijklmnopqrstuvwxyzABCDEF12345678"))
+
+	filtered := make([]string, 0, len(envVars))
+	for _, e := range envVars {
+		if !strings.HasPrefix(e, "CLOUDFLARE_VAULT_SESSION=") {
+			filtered = append(filtered, e)
+		}
+	}
+
+	if result := runCfVault(t, filtered, "exec", "tokenprofile", "--", "true"); result.ExitCode != 0 {
+		t.Fatalf("expected exit 0, got %d\nstderr: %s", result.ExitCode, result.Stderr)
+	}
+
+	// Refused before the keyring is open, so the record can't be signed.
+	result := runCfVault(t, filtered, "exec", "confirmprofile", "--", "true")
+	if result.ExitCode == 0 {
+		t.Fatal("expected the unconfirmed session to be refused")
+	}
+	if !strings.Contains(result.Stderr, "not writing the exec audit record") {
+		t.Errorf("expected the unsigned record to be skipped, got:\n%s", result.Stderr)
+	}
+
+	// Refused after the keyring is open, so the record is signed.
+	if result := runCfVault(t, filtered, "exec", "tokenprofile", "--", "cf-vault-no-such-executable"); result.ExitCode == 0 {
+		t.Fatal("expected a missing executable to fail")
+	}
+
+	result = runCfVault(t, filtered, "audit", "verify")
+	if result.ExitCode != 0 {
+		t.Fatalf("expected an intact log, got exit %d\nstdout: %s\nstderr: %s", result.ExitCode, result.Stdout, result.Stderr)
+	}
+	if !strings.Contains(result.Stdout, "2 records") {
+		t.Errorf("expected the successful and the signed refused session, got:\n%s", result.Stdout)
+	}
+}
+
+func TestIntegration_AuditVerify(t *testing.T) {
+	configDir, keyringDir, envVars, cleanup := setupTestEnv(t)
+	defer cleanup()
+
+	writeConfig(t, configDir, `
+audit_hmac = true
+
+[profiles]
+  [profiles.tokenprofile]
+    auth_type = "api_token"
+`)
+	writeKeyringItem(t, keyringDir, "tokenprofile-api_token", []byte("abcdefghijklmnopqrstuvwxyzABCDEF12345678"))
+
+	filtered := make([]string, 0, len(envVars))
+	for _, e := range envVars {
+		if !strings.HasPrefix(e, "CLOUDFLARE_VAULT_SESSION=") {
+			filtered = append(filtered, e)
+		}
+	}
+
+	for i := 0; i < 2; i++ {
+		if result := runCfVault(t, filtered, "exec", "tokenprofile", "--", "true"); result.ExitCode != 0 {
+			t.Fatalf("expected exit 0, got %d\nstderr: %s", result.ExitCode, result.Stderr)
+		}
+	}
+
+	result := runCfVault(t, filtered, "audit", "verify")
+	if result.ExitCode != 0 {
+		t.Fatalf("expected an intact log, got exit %d\nstdout: %s\nstderr: %s", result.ExitCode, result.Stdout, result.Stderr)
+	}
+	if !strings.Contains(result.Stdout, "2 records, hash chain and HMACs intact") {
+		t.Errorf("unexpected output:\n%s", result.Stdout)
+	}
+
+	result = runCfVault(t, filtered, "audit", "verify", "--output", "json")
+	var verification auditVerification
+	if err := json.Unmarshal([]byte(result.Stdout), &verification); err != nil {
+		t.Fatalf("expected JSON output, got error %v\nstdout: %s", err, result.Stdout)
+	}
+	if !verification.Intact || !verification.HMAC || verification.Records != 2 {
+		t.Errorf("unexpected verification: %+v", verification)
+	}
+
+	auditLog := filepath.Join(filepath.Dir(keyringDir), "audit.log")
+	data, err := os.ReadFile(auditLog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(auditLog, []byte(strings.Replace(string(data), `"exit_code":0`, `"exit_code":1`, 1)), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	result = runCfVault(t, filtered, "audit", "verify")
+	if result.ExitCode == 0 {
+		t.Fatalf("expected the edited log to fail verification\nstdout: %s", result.Stdout)
+	}
+	if !strings.Contains(result.Stdout, "record 1: HMAC mismatch") {
+		t.Errorf("expected the edited record to be reported, got:\n%s", result.Stdout)
+	}
+}
+
+func TestIntegration_Exec_AllowedWindow(t *testing.T) {
+	configDir, keyringDir, envVars, cleanup := setupTestEnv(t)
+	defer cleanup()
+
+	// A one minute window twelve hours from now is never open during the test.
+	closed := time.Now().UTC().Add(12 * time.Hour)
+	writeConfig(t, configDir, fmt.Sprintf(`
+[profiles]
+  [profiles.production]
+    auth_type = "api_token"
+
+    [profiles.production.allowed_window]
+      start = "%s"
+      end = "%s"
+      timezone = "UTC"
+`, closed.Format("15:04"), closed.Add(time.Minute).Format("15:04")))
+	writeKeyringItem(t, keyringDir, "production-api_token", []byte("abcdefghijklmnopqrstuvwxyzABCDEF12345678"))
+
+	filtered := make([]string, 0, len(envVars))
+	for _, e := range envVars {
+		if !strings.HasPrefix(e, "CLOUDFLARE_VAULT_SESSION=") {
+			filtered = append(filtered, e)
+		}
+	}
+
+	result := runCfVault(t, filtered, "exec", "production", "--", "true")
+	if result.ExitCode == 0 || !strings.Contains(result.Stderr, "may only be used") {
+		t.Errorf("expected use outside the window to be refused, got exit %d\nstderr: %s", result.ExitCode, result.Stderr)
+	}
+
+	result = runCfVault(t, filtered, "exec", "--break-glass", "production", "--", "true")
+	if result.ExitCode == 0 || !strings.Contains(result.Stderr, "requires a --reason") {
+		t.Errorf("expected --break-glass without a reason to be refused, got exit %d\nstderr: %s", result.ExitCode, result.Stderr)
+	}
+
+	result = runCfVault(t, filtered, "exec", "--break-glass", "--reason", "incident 1234", "production", "--", "true")
+	if result.ExitCode != 0 {
+		t.Fatalf("expected break glass to be allowed, got exit %d\nstderr: %s", result.ExitCode, result.Stderr)
+	}
+
+	result = runCfVault(t, filtered, "audit", "--output", "json", "--event", "break_glass")
+	if !strings.Contains(result.Stdout, `"reason": "incident 1234"`) {
+		t.Errorf("expected the break glass reason in the audit log, got:\n%s", result.Stdout)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 
 	"github.com/olekukonko/tablewriter"
 	"github.com/pelletier/go-toml"
@@ -15,36 +16,68 @@ var listCmd = &cobra.Command{
 	Use:   "list",
 	Short: "List all available profiles",
 	Long:  "",
+	Example: `
+  List the profiles as a table
+
+    $ cf-vault list
+
+  List every setting of the profiles as JSON
+
+    $ cf-vault list --output json
+`,
 	PreRun: func(cmd *cobra.Command, args []string) {
 		if verbose {
 			log.SetLevel(log.DebugLevel)
 		}
 	},
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
+		format, err := resolveOutputFormat()
+		if err != nil {
+			return err
+		}
+
 		configDir, err := resolveConfigDir()
 		if err != nil {
-			log.Fatal(err)
+			return err
 		}
 		configPath := filepath.Join(configDir, "config.toml")
 
-		configData, err := os.ReadFile(configPath)
-		if err != nil {
-			log.Fatal(err)
+		if err := verifyPermissions(configDir); err != nil {
+			return err
 		}
 
-		config := tomlConfig{}
-		err = toml.Unmarshal(configData, &config)
+		config, err := readConfig(configPath)
 		if err != nil {
-			log.Fatal(err)
+			return err
+		}
+
+		profileNames := make([]string, 0, len(config.Profiles))
+		for name := range config.Profiles {
+			profileNames = append(profileNames, name)
+		}
+		sort.Strings(profileNames)
+
+		if format != outputTable {
+			listings := make([]map[string]interface{}, 0, len(profileNames))
+			for _, name := range profileNames {
+				listing, err := profileListing(name, config.Profiles[name])
+				if err != nil {
+					return err
+				}
+				listings = append(listings, listing)
+			}
+			return writeStructured(os.Stdout, format, listings)
 		}
 
 		if len(config.Profiles) == 0 {
 			fmt.Printf("no profiles found at %s\n", configPath)
-			os.Exit(0)
+			return nil
 		}
 
 		tableData := [][]string{}
-		for profileName, profile := range config.Profiles {
+		for _, profileName := range profileNames {
+			profile := config.Profiles[profileName]
+
 			// Only display the email if we're using API tokens otherwise the value is
 			// not used and pretty superfluous.
 			var emailString string
@@ -74,5 +107,26 @@ var listCmd = &cobra.Command{
 		table.SetNoWhiteSpace(true)
 		table.AppendBulk(tableData)
 		table.Render()
+
+		return nil
 	},
 }
+
+// profileListing returns every setting of the profile keyed by its name in
+// the configuration file, along with the profile's name and the number of
+// policies it has.
+func profileListing(name string, p profile) (map[string]interface{}, error) {
+	data, err := toml.Marshal(p)
+	if err != nil {
+		return nil, err
+	}
+	tree, err := toml.LoadBytes(data)
+	if err != nil {
+		return nil, err
+	}
+
+	listing := tree.ToMap()
+	listing["name"] = name
+	listing["policy_count"] = len(p.Policies)
+	return listing, nil
+}
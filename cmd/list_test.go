@@ -0,0 +1,34 @@
+package cmd
+
+import "testing"
+
+func TestProfileListing(t *testing.T) {
+	listing, err := profileListing("work", profile{
+		AuthType:        "api_token",
+		SessionDuration: "15m",
+		AllowedIPs:      []string{"192.0.2.0/24"},
+		Template:        "read-only",
+		Policies:        validPolicies(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for key, want := range map[string]interface{}{
+		"name":             "work",
+		"auth_type":        "api_token",
+		"session_duration": "15m",
+		"template":         "read-only",
+		"policy_count":     len(validPolicies()),
+	} {
+		if listing[key] != want {
+			t.Errorf("expected %s to be %v, got %v", key, want, listing[key])
+		}
+	}
+	if ips, _ := listing["allowed_ips"].([]interface{}); len(ips) != 1 || ips[0] != "192.0.2.0/24" {
+		t.Errorf("expected allowed_ips to be listed, got %v", listing["allowed_ips"])
+	}
+	if _, ok := listing["policies"]; !ok {
+		t.Error("expected the policies to be listed")
+	}
+}
@@ -0,0 +1,83 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/cloudflare/cloudflare-go/v6"
+	"github.com/cloudflare/cloudflare-go/v6/accounts"
+	"github.com/cloudflare/cloudflare-go/v6/zones"
+)
+
+// resolveAccountID returns the ID of the account with the given name.
+func resolveAccountID(ctx context.Context, client *cloudflare.Client, name string) (string, error) {
+	page, err := client.Accounts.List(ctx, accounts.AccountListParams{Name: cloudflare.F(name)})
+	if err != nil {
+		return "", fmt.Errorf("failed to look up account %q: %w", name, err)
+	}
+
+	var ids []string
+	for _, a := range page.Result {
+		if a.Name == name {
+			ids = append(ids, a.ID)
+		}
+	}
+
+	switch len(ids) {
+	case 0:
+		return "", fmt.Errorf("no account named %q is accessible with this credential", name)
+	case 1:
+		return ids[0], nil
+	default:
+		return "", fmt.Errorf("multiple accounts are named %q, set account_id instead", name)
+	}
+}
+
+// resolveZoneID returns the ID of the zone with the given name, optionally
+// limited to a single account.
+func resolveZoneID(ctx context.Context, client *cloudflare.Client, name, accountID string) (string, error) {
+	params := zones.ZoneListParams{Name: cloudflare.F(name)}
+	if accountID != "" {
+		params.Account = cloudflare.F(zones.ZoneListParamsAccount{ID: cloudflare.F(accountID)})
+	}
+
+	page, err := client.Zones.List(ctx, params)
+	if err != nil {
+		return "", fmt.Errorf("failed to look up zone %q: %w", name, err)
+	}
+
+	switch len(page.Result) {
+	case 0:
+		return "", fmt.Errorf("no zone named %q is accessible with this credential", name)
+	case 1:
+		return page.Result[0].ID, nil
+	default:
+		return "", fmt.Errorf("multiple zones are named %q, set account_id or zone_id to disambiguate", name)
+	}
+}
+
+// promptAccount asks the user to pick one of the accounts by number and
+// returns its ID. An empty answer skips the selection.
+func promptAccount(r *bufio.Reader, w io.Writer, choices []accounts.Account) (string, error) {
+	fmt.Fprintln(w, "Accounts available to this credential:")
+	for i, a := range choices {
+		fmt.Fprintf(w, "  %d) %s (%s)\n", i+1, a.Name, a.ID)
+	}
+	fmt.Fprint(w, "Account to associate with this profile (leave blank for none): ")
+
+	answer, _ := r.ReadString('\n')
+	answer = strings.TrimSpace(answer)
+	if answer == "" {
+		return "", nil
+	}
+
+	n, err := strconv.Atoi(answer)
+	if err != nil || n < 1 || n > len(choices) {
+		return "", fmt.Errorf("invalid account selection %q, expected a number between 1 and %d", answer, len(choices))
+	}
+	return choices[n-1].ID, nil
+}
@@ -0,0 +1,131 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/cloudflare/cloudflare-go/v6/accounts"
+)
+
+// newMockListServer serves result as a paginated list response on path and
+// records the query string of the last request.
+func newMockListServer(t *testing.T, path string, result []map[string]interface{}, query *string) *httptest.Server {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+		*query = r.URL.RawQuery
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success":     true,
+			"errors":      []interface{}{},
+			"messages":    []interface{}{},
+			"result":      result,
+			"result_info": map[string]interface{}{"page": 1, "per_page": 20, "count": len(result), "total_count": len(result)},
+		})
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestResolveAccountID(t *testing.T) {
+	var query string
+	srv := newMockListServer(t, "/accounts", []map[string]interface{}{
+		{"id": "acct-1", "name": "Example Corp"},
+		{"id": "acct-2", "name": "Example Corp Staging"},
+	}, &query)
+
+	id, err := resolveAccountID(context.Background(), newTestClient(t, srv.URL), "Example Corp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != "acct-1" {
+		t.Errorf("expected acct-1, got %s", id)
+	}
+	if !strings.Contains(query, "name=Example+Corp") {
+		t.Errorf("expected name filter in query, got %q", query)
+	}
+}
+
+func TestResolveAccountID_NotFound(t *testing.T) {
+	var query string
+	srv := newMockListServer(t, "/accounts", []map[string]interface{}{}, &query)
+
+	_, err := resolveAccountID(context.Background(), newTestClient(t, srv.URL), "Missing")
+	if err == nil || !strings.Contains(err.Error(), "no account named") {
+		t.Errorf("expected not found error, got: %v", err)
+	}
+}
+
+func TestResolveZoneID(t *testing.T) {
+	var query string
+	srv := newMockListServer(t, "/zones", []map[string]interface{}{
+		{"id": "zone-1", "name": "example.com"},
+	}, &query)
+
+	id, err := resolveZoneID(context.Background(), newTestClient(t, srv.URL), "example.com", "acct-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != "zone-1" {
+		t.Errorf("expected zone-1, got %s", id)
+	}
+	if !strings.Contains(query, "account.id=acct-1") {
+		t.Errorf("expected account filter in query, got %q", query)
+	}
+}
+
+func TestResolveZoneID_Ambiguous(t *testing.T) {
+	var query string
+	srv := newMockListServer(t, "/zones", []map[string]interface{}{
+		{"id": "zone-1", "name": "example.com"},
+		{"id": "zone-2", "name": "example.com"},
+	}, &query)
+
+	_, err := resolveZoneID(context.Background(), newTestClient(t, srv.URL), "example.com", "")
+	if err == nil || !strings.Contains(err.Error(), "multiple zones") {
+		t.Errorf("expected ambiguity error, got: %v", err)
+	}
+}
+
+var promptChoices = []accounts.Account{
+	{ID: "acct-1", Name: "First"},
+	{ID: "acct-2", Name: "Second"},
+}
+
+func TestPromptAccount_Selection(t *testing.T) {
+	var out bytes.Buffer
+	id, err := promptAccount(bufio.NewReader(strings.NewReader("2\n")), &out, promptChoices)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != "acct-2" {
+		t.Errorf("expected acct-2, got %s", id)
+	}
+	if !strings.Contains(out.String(), "1) First (acct-1)") {
+		t.Errorf("expected numbered account list, got %q", out.String())
+	}
+}
+
+func TestPromptAccount_Skip(t *testing.T) {
+	id, err := promptAccount(bufio.NewReader(strings.NewReader("\n")), &bytes.Buffer{}, promptChoices)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != "" {
+		t.Errorf("expected no account to be selected, got %s", id)
+	}
+}
+
+func TestPromptAccount_Invalid(t *testing.T) {
+	_, err := promptAccount(bufio.NewReader(strings.NewReader("3\n")), &bytes.Buffer{}, promptChoices)
+	if err == nil {
+		t.Fatal("expected error for out of range selection, got nil")
+	}
+}
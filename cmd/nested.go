@@ -0,0 +1,81 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	nestedSessionsDeny             = "deny"
+	nestedSessionsReplace          = "replace"
+	nestedSessionsAllowSameProfile = "allow-same-profile"
+)
+
+// validateNestedSessions checks a nested_sessions setting. An empty value
+// falls back to the default.
+func validateNestedSessions(value string) error {
+	switch value {
+	case "", nestedSessionsDeny, nestedSessionsReplace, nestedSessionsAllowSameProfile:
+		return nil
+	default:
+		return fmt.Errorf("nested_sessions must be %q, %q or %q, got %q", nestedSessionsDeny, nestedSessionsReplace, nestedSessionsAllowSameProfile, value)
+	}
+}
+
+// nestedSessionPolicy returns how `exec` behaves when started inside another
+// session. The profile's setting takes precedence over the global one.
+func nestedSessionPolicy(config tomlConfig, p profile) string {
+	if p.NestedSessions != "" {
+		return p.NestedSessions
+	}
+	if config.NestedSessions != "" {
+		return config.NestedSessions
+	}
+	return nestedSessionsDeny
+}
+
+// sessionVars are the variables describing an outer session rather than
+// holding its credentials. They are cleared for every nested session, even one
+// for the same profile, so the inner session doesn't report the outer
+// session's expiry or read its refreshed token files.
+var sessionVars = []string{
+	"CLOUDFLARE_SESSION_EXPIRY",
+	"CLOUDFLARE_VAULT_EXPIRY_FILE",
+	"CLOUDFLARE_VAULT_TOKEN_FILE",
+	"CLOUDFLARE_ACCOUNT_ID",
+	"CF_ACCOUNT_ID",
+	"CLOUDFLARE_ZONE_ID",
+	"CF_ZONE_ID",
+}
+
+// isCloudflareVar reports whether an environment variable belongs to a
+// Cloudflare session. cf-vault's own CF_VAULT_* settings are excluded.
+func isCloudflareVar(key string) bool {
+	if strings.HasPrefix(key, "CF_VAULT_") {
+		return false
+	}
+	return strings.HasPrefix(key, "CLOUDFLARE_") || strings.HasPrefix(key, "CF_")
+}
+
+// withoutCloudflareVars returns a copy of e without any Cloudflare variables
+// so a nested session starts fresh.
+func (e environ) withoutCloudflareVars() environ {
+	out := environ{}
+	for _, kv := range e {
+		key, _, _ := strings.Cut(kv, "=")
+		if !isCloudflareVar(key) {
+			out = append(out, kv)
+		}
+	}
+	return out
+}
+
+// withoutSessionVars returns a copy of e without the outer session's
+// sessionVars.
+func (e environ) withoutSessionVars() environ {
+	out := append(environ{}, e...)
+	for _, key := range sessionVars {
+		out.Unset(key)
+	}
+	return out
+}
@@ -0,0 +1,61 @@
+package cmd
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNestedSessionPolicy(t *testing.T) {
+	tests := []struct {
+		name   string
+		config tomlConfig
+		p      profile
+		want   string
+	}{
+		{"default", tomlConfig{}, profile{}, nestedSessionsDeny},
+		{"global", tomlConfig{NestedSessions: nestedSessionsReplace}, profile{}, nestedSessionsReplace},
+		{"profile overrides global", tomlConfig{NestedSessions: nestedSessionsReplace}, profile{NestedSessions: nestedSessionsAllowSameProfile}, nestedSessionsAllowSameProfile},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := nestedSessionPolicy(tt.config, tt.p); got != tt.want {
+				t.Errorf("expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestWithoutSessionVars(t *testing.T) {
+	e := environ{
+		"HOME=/home/user",
+		"CLOUDFLARE_VAULT_SESSION=read",
+		"CLOUDFLARE_API_TOKEN=s3cr3t",
+		"CLOUDFLARE_SESSION_EXPIRY=1700000000",
+		"CLOUDFLARE_VAULT_EXPIRY_FILE=/tmp/cf-vault/expiry",
+		"CLOUDFLARE_VAULT_TOKEN_FILE=/tmp/cf-vault/token",
+		"CLOUDFLARE_ACCOUNT_ID=123",
+		"CF_ZONE_ID=456",
+	}
+
+	want := environ{"HOME=/home/user", "CLOUDFLARE_VAULT_SESSION=read", "CLOUDFLARE_API_TOKEN=s3cr3t"}
+	if got := e.withoutSessionVars(); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+}
+
+func TestWithoutCloudflareVars(t *testing.T) {
+	e := environ{
+		"HOME=/home/user",
+		"CLOUDFLARE_VAULT_SESSION=read",
+		"CLOUDFLARE_API_TOKEN=s3cr3t",
+		"CF_API_TOKEN=s3cr3t",
+		"CF_VAULT_BACKEND=file",
+		"MY_CF_VAR=kept",
+	}
+
+	want := environ{"HOME=/home/user", "CF_VAULT_BACKEND=file", "MY_CF_VAR=kept"}
+	if got := e.withoutCloudflareVars(); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+}
@@ -0,0 +1,49 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	outputTable = "table"
+	outputJSON  = "json"
+	outputYAML  = "yaml"
+)
+
+// outputFormat is the format set with the global --output flag.
+var outputFormat string
+
+// resolveOutputFormat returns the validated --output format.
+func resolveOutputFormat() (string, error) {
+	switch outputFormat {
+	case "", outputTable:
+		return outputTable, nil
+	case outputJSON, outputYAML:
+		return outputFormat, nil
+	default:
+		return "", fmt.Errorf("unknown output format %q, valid formats: [table, json, yaml]", outputFormat)
+	}
+}
+
+// writeStructured encodes v to w as JSON or YAML.
+func writeStructured(w io.Writer, format string, v interface{}) error {
+	switch format {
+	case outputJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	case outputYAML:
+		enc := yaml.NewEncoder(w)
+		enc.SetIndent(2)
+		if err := enc.Encode(v); err != nil {
+			return err
+		}
+		return enc.Close()
+	default:
+		return fmt.Errorf("%q is not a structured output format", format)
+	}
+}
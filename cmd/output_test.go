@@ -0,0 +1,54 @@
+package cmd
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestResolveOutputFormat(t *testing.T) {
+	defer func(format string) { outputFormat = format }(outputFormat)
+
+	tests := map[string]string{
+		"":      outputTable,
+		"table": outputTable,
+		"json":  outputJSON,
+		"yaml":  outputYAML,
+	}
+	for in, want := range tests {
+		outputFormat = in
+		got, err := resolveOutputFormat()
+		if err != nil || got != want {
+			t.Errorf("%q: expected %q, got %q (%v)", in, want, got, err)
+		}
+	}
+
+	outputFormat = "xml"
+	if _, err := resolveOutputFormat(); err == nil || !strings.Contains(err.Error(), "unknown output format") {
+		t.Errorf("expected unknown output format error, got: %v", err)
+	}
+}
+
+func TestWriteStructured(t *testing.T) {
+	v := []doctorCheck{{Name: "shell", Status: checkOK, Message: "/bin/sh"}}
+
+	var buf bytes.Buffer
+	if err := writeStructured(&buf, outputJSON, v); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), `"name": "shell"`) {
+		t.Errorf("unexpected JSON output:\n%s", buf.String())
+	}
+
+	buf.Reset()
+	if err := writeStructured(&buf, outputYAML, v); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "- name: shell\n  status: ok\n  message: /bin/sh\n" {
+		t.Errorf("unexpected YAML output:\n%s", buf.String())
+	}
+
+	if err := writeStructured(&buf, outputTable, v); err == nil {
+		t.Error("expected table to be rejected as a structured format")
+	}
+}
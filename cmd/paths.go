@@ -54,6 +54,23 @@ func resolveKeyringDir() (string, error) {
 	return filepath.Join(home, "."+projectName, "keys"), nil
 }
 
+// resolveAuditLogPath returns the path of the audit log. If XDG_DATA_HOME is
+// set it returns $XDG_DATA_HOME/cf-vault/audit.log; otherwise it falls back to
+// the legacy ~/.cf-vault/audit.log path.
+func resolveAuditLogPath() (string, error) {
+	home, err := homedir.Dir()
+	if err != nil {
+		return "", fmt.Errorf("unable to find home directory: %w", err)
+	}
+
+	xdgDataHome := os.Getenv("XDG_DATA_HOME")
+	if xdgDataHome != "" {
+		return filepath.Join(xdgDataHome, projectName, "audit.log"), nil
+	}
+
+	return filepath.Join(home, "."+projectName, "audit.log"), nil
+}
+
 // openKeyring opens the keyring backend with paths resolved via resolveKeyringDir.
 // If CF_VAULT_BACKEND is set, it selects that backend exclusively; otherwise the
 // defaults from keyringDefaults apply.
@@ -0,0 +1,114 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// privatePaths returns the config directory, config file, keyring directory,
+// the keyring's item files and the audit log and its head that exist on disk.
+// These must not be accessible by anyone other than the current user.
+func privatePaths(configDir string) ([]string, error) {
+	keyringDir, err := resolveKeyringDir()
+	if err != nil {
+		return nil, err
+	}
+
+	auditLogPath, err := resolveAuditLogPath()
+	if err != nil {
+		return nil, err
+	}
+
+	candidates := []string{
+		configDir,
+		filepath.Join(configDir, "config.toml"),
+		keyringDir,
+		auditLogPath,
+		auditHeadPath(auditLogPath),
+	}
+
+	entries, err := os.ReadDir(keyringDir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	for _, e := range entries {
+		if e.Type().IsRegular() {
+			candidates = append(candidates, filepath.Join(keyringDir, e.Name()))
+		}
+	}
+
+	var paths []string
+	for _, p := range candidates {
+		if _, err := os.Stat(p); err == nil {
+			paths = append(paths, p)
+		}
+	}
+	return paths, nil
+}
+
+// insecurePaths returns every private path that is group or world readable
+// or writable.
+func insecurePaths(configDir string) ([]string, error) {
+	// Windows doesn't have POSIX permission bits to inspect.
+	if runtime.GOOS == "windows" {
+		return nil, nil
+	}
+
+	paths, err := privatePaths(configDir)
+	if err != nil {
+		return nil, err
+	}
+
+	var insecure []string
+	for _, p := range paths {
+		info, err := os.Stat(p)
+		if err != nil {
+			return nil, err
+		}
+		if info.Mode().Perm()&0077 != 0 {
+			insecure = append(insecure, p)
+		}
+	}
+	return insecure, nil
+}
+
+// verifyPermissions returns an error describing any private paths with
+// insecure permissions unless --allow-insecure-permissions has been passed.
+func verifyPermissions(configDir string) error {
+	if allowInsecurePermissions {
+		return nil
+	}
+
+	insecure, err := insecurePaths(configDir)
+	if err != nil {
+		return fmt.Errorf("failed to check file permissions: %w", err)
+	}
+	if len(insecure) == 0 {
+		return nil
+	}
+
+	return fmt.Errorf("refusing to continue as the following paths are accessible by group or others: %s. Run `%s doctor --fix` to tighten the permissions or pass --allow-insecure-permissions to ignore this check", strings.Join(insecure, ", "), projectName)
+}
+
+// fixPermissions removes group and world access from every insecure private
+// path and returns the paths that were changed.
+func fixPermissions(configDir string) ([]string, error) {
+	insecure, err := insecurePaths(configDir)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, p := range insecure {
+		info, err := os.Stat(p)
+		if err != nil {
+			return nil, err
+		}
+		if err := os.Chmod(p, info.Mode().Perm()&^0077); err != nil {
+			return nil, fmt.Errorf("failed to fix permissions on %s: %w", p, err)
+		}
+	}
+	return insecure, nil
+}
@@ -0,0 +1,126 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// setupPrivateDirs points the keyring at a temp dir and returns a config dir
+// containing a config file with the given mode.
+func setupPrivateDirs(t *testing.T, configMode os.FileMode) (configDir string, keyringDir string) {
+	t.Helper()
+
+	tmp := t.TempDir()
+	configDir = filepath.Join(tmp, "config")
+	keyringDir = filepath.Join(tmp, "data", projectName, "keys")
+	t.Setenv("XDG_DATA_HOME", filepath.Join(tmp, "data"))
+
+	for _, d := range []string{configDir, keyringDir} {
+		if err := os.MkdirAll(d, 0700); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	configPath := filepath.Join(configDir, "config.toml")
+	if err := os.WriteFile(configPath, []byte(""), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(configPath, configMode); err != nil {
+		t.Fatal(err)
+	}
+
+	return configDir, keyringDir
+}
+
+func TestInsecurePaths_Secure(t *testing.T) {
+	configDir, _ := setupPrivateDirs(t, 0600)
+
+	insecure, err := insecurePaths(configDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(insecure) != 0 {
+		t.Errorf("expected no insecure paths, got %v", insecure)
+	}
+}
+
+func TestInsecurePaths_WorldReadableConfig(t *testing.T) {
+	configDir, _ := setupPrivateDirs(t, 0644)
+
+	insecure, err := insecurePaths(configDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := filepath.Join(configDir, "config.toml")
+	if len(insecure) != 1 || insecure[0] != want {
+		t.Errorf("expected only %s to be insecure, got %v", want, insecure)
+	}
+}
+
+func TestInsecurePaths_KeyringFiles(t *testing.T) {
+	configDir, keyringDir := setupPrivateDirs(t, 0600)
+
+	keyFile := filepath.Join(keyringDir, "example-api_token")
+	if err := os.WriteFile(keyFile, []byte("secret"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(keyFile, 0640); err != nil {
+		t.Fatal(err)
+	}
+
+	insecure, err := insecurePaths(configDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(insecure) != 1 || insecure[0] != keyFile {
+		t.Errorf("expected only %s to be insecure, got %v", keyFile, insecure)
+	}
+}
+
+func TestVerifyPermissions(t *testing.T) {
+	configDir, _ := setupPrivateDirs(t, 0666)
+
+	err := verifyPermissions(configDir)
+	if err == nil {
+		t.Fatal("expected error for world writable config, got nil")
+	}
+	if !strings.Contains(err.Error(), "doctor --fix") {
+		t.Errorf("expected error to mention doctor --fix, got: %v", err)
+	}
+
+	allowInsecurePermissions = true
+	defer func() { allowInsecurePermissions = false }()
+	if err := verifyPermissions(configDir); err != nil {
+		t.Errorf("expected no error with --allow-insecure-permissions, got: %v", err)
+	}
+}
+
+func TestFixPermissions(t *testing.T) {
+	configDir, _ := setupPrivateDirs(t, 0664)
+	if err := os.Chmod(configDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	fixed, err := fixPermissions(configDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fixed) != 2 {
+		t.Errorf("expected 2 paths to be fixed, got %v", fixed)
+	}
+
+	for path, want := range map[string]os.FileMode{
+		configDir:                               0700,
+		filepath.Join(configDir, "config.toml"): 0600,
+	} {
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := info.Mode().Perm(); got != want {
+			t.Errorf("expected %s to have mode %04o, got %04o", path, want, got)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+const (
+	promptColourGreen  = "\033[32m"
+	promptColourYellow = "\033[33m"
+	promptColourRed    = "\033[31m"
+	promptColourReset  = "\033[0m"
+
+	// Sessions with less time than these left are shown in yellow and red.
+	promptWarnRemaining     = 10 * time.Minute
+	promptCriticalRemaining = 2 * time.Minute
+)
+
+// promptSnippets are the shell snippets printed by `prompt --init` which
+// prepend the session to the existing prompt.
+var promptSnippets = map[string]string{
+	"bash": `PS1='$(cf-vault prompt --shell bash)'"$PS1"
+`,
+	"zsh": `setopt PROMPT_SUBST
+PROMPT='$(cf-vault prompt --shell zsh)'"$PROMPT"
+`,
+	"fish": `functions -q __cf_vault_fish_prompt; or functions -c fish_prompt __cf_vault_fish_prompt
+function fish_prompt
+    cf-vault prompt --shell fish
+    __cf_vault_fish_prompt
+end
+`,
+}
+
+var promptCmd = &cobra.Command{
+	Use:   "prompt",
+	Short: "Print the current session for use in a shell prompt",
+	Long:  "",
+	Example: `
+  Show the session in the bash prompt (add to ~/.bashrc)
+
+    eval "$(cf-vault prompt --init bash)"
+
+  Show the session in the zsh prompt (add to ~/.zshrc)
+
+    eval "$(cf-vault prompt --init zsh)"
+
+  Show the session in the fish prompt (add to ~/.config/fish/config.fish)
+
+    cf-vault prompt --init fish | source
+`,
+	PreRun: func(cmd *cobra.Command, args []string) {
+		if verbose {
+			log.SetLevel(log.DebugLevel)
+		}
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		initShell, _ := cmd.Flags().GetString("init")
+		shell, _ := cmd.Flags().GetString("shell")
+		noColour, _ := cmd.Flags().GetBool("no-color")
+
+		if initShell != "" {
+			snippet, ok := promptSnippets[initShell]
+			if !ok {
+				return fmt.Errorf("unknown shell %q, valid shells: [bash, zsh, fish]", initShell)
+			}
+			fmt.Print(snippet)
+			return nil
+		}
+
+		// This runs on every prompt so it must stay cheap: only the
+		// environment and the expiry file are read, never the keyring or the
+		// network. Errors are swallowed so a broken session doesn't break the
+		// prompt.
+		profileName := os.Getenv("CLOUDFLARE_VAULT_SESSION")
+		if profileName == "" {
+			return nil
+		}
+
+		expiresAt, err := sessionExpiry()
+		if err != nil {
+			log.Debug(err)
+		}
+
+		colour := !noColour && os.Getenv("NO_COLOR") == ""
+		fmt.Print(renderPrompt(profileName, expiresAt, time.Now(), shell, colour))
+
+		return nil
+	},
+}
+
+// renderPrompt formats the session as `[profile countdown] `, coloured by how
+// much time is left. Colour codes are wrapped in the markers the shell needs
+// to work out the visible width of the prompt.
+func renderPrompt(profileName string, expiresAt, now time.Time, shell string, colour bool) string {
+	if shell == "zsh" {
+		profileName = strings.ReplaceAll(profileName, "%", "%%")
+	}
+
+	text := profileName
+	code := promptColourGreen
+	if !expiresAt.IsZero() {
+		remaining := expiresAt.Sub(now)
+		text += " " + formatCountdown(remaining)
+		switch {
+		case remaining < promptCriticalRemaining:
+			code = promptColourRed
+		case remaining < promptWarnRemaining:
+			code = promptColourYellow
+		}
+	}
+
+	if !colour {
+		return fmt.Sprintf("[%s] ", text)
+	}
+	return fmt.Sprintf("[%s%s%s] ", promptEscape(code, shell), text, promptEscape(promptColourReset, shell))
+}
+
+// promptEscape marks an escape sequence as zero width for the shell.
+func promptEscape(code, shell string) string {
+	switch shell {
+	case "bash":
+		return "\001" + code + "\002"
+	case "zsh":
+		return "%{" + code + "%}"
+	default:
+		return code
+	}
+}
+
+// formatCountdown renders the time left in a compact form such as `1h5m`,
+// `12m` or `40s`.
+func formatCountdown(remaining time.Duration) string {
+	if remaining <= 0 {
+		return "expired"
+	}
+	if remaining < time.Minute {
+		return fmt.Sprintf("%ds", int(remaining.Seconds()))
+	}
+
+	remaining = remaining.Truncate(time.Minute)
+	hours := int(remaining.Hours())
+	minutes := int(remaining.Minutes()) % 60
+	if hours > 0 {
+		return fmt.Sprintf("%dh%dm", hours, minutes)
+	}
+	return fmt.Sprintf("%dm", minutes)
+}
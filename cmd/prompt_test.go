@@ -0,0 +1,55 @@
+package cmd
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFormatCountdown(t *testing.T) {
+	tests := []struct {
+		remaining time.Duration
+		want      string
+	}{
+		{-time.Second, "expired"},
+		{0, "expired"},
+		{40 * time.Second, "40s"},
+		{12*time.Minute + 30*time.Second, "12m"},
+		{65 * time.Minute, "1h5m"},
+	}
+
+	for _, tt := range tests {
+		if got := formatCountdown(tt.remaining); got != tt.want {
+			t.Errorf("formatCountdown(%s) = %q, want %q", tt.remaining, got, tt.want)
+		}
+	}
+}
+
+func TestRenderPrompt(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+
+	tests := []struct {
+		name      string
+		profile   string
+		expiresAt time.Time
+		shell     string
+		colour    bool
+		want      string
+	}{
+		{"static credentials", "work", time.Time{}, "", false, "[work] "},
+		{"countdown", "work", now.Add(30 * time.Minute), "", false, "[work 30m] "},
+		{"plenty of time", "work", now.Add(30 * time.Minute), "", true, "[\033[32mwork 30m\033[0m] "},
+		{"expiring soon", "work", now.Add(5 * time.Minute), "", true, "[\033[33mwork 5m\033[0m] "},
+		{"nearly expired", "work", now.Add(time.Minute), "", true, "[\033[31mwork 1m\033[0m] "},
+		{"expired", "work", now.Add(-time.Minute), "", true, "[\033[31mwork expired\033[0m] "},
+		{"bash markers", "work", time.Time{}, "bash", true, "[\001\033[32m\002work\001\033[0m\002] "},
+		{"zsh markers", "100%", time.Time{}, "zsh", true, "[%{\033[32m%}100%%%{\033[0m%}] "},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := renderPrompt(tt.profile, tt.expiresAt, now, tt.shell, tt.colour); got != tt.want {
+				t.Errorf("renderPrompt() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,20 @@
+package cmd
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+)
+
+// r2Credentials derives the S3 compatible access key pair for R2 from an API
+// token. The access key ID is the token ID and the secret access key is the
+// SHA-256 hash of the token value.
+func r2Credentials(tokenID, tokenValue string) (accessKeyID, secretAccessKey string) {
+	sum := sha256.Sum256([]byte(tokenValue))
+	return tokenID, hex.EncodeToString(sum[:])
+}
+
+// r2Endpoint returns the S3 API endpoint for R2 in the given account.
+func r2Endpoint(accountID string) string {
+	return fmt.Sprintf("https://%s.r2.cloudflarestorage.com", accountID)
+}
@@ -0,0 +1,25 @@
+package cmd
+
+import "testing"
+
+func TestR2Credentials(t *testing.T) {
+	accessKeyID, secretAccessKey := r2Credentials("token-id", "token-value")
+
+	if accessKeyID != "token-id" {
+		t.Errorf("expected access key ID to be the token ID, got %q", accessKeyID)
+	}
+
+	// printf "token-value" | shasum -a 256
+	want := "e6c02a5742ea9d4de588eb9b9de7bed43dc17011552186bed3e98b2c5958ff4a"
+	if secretAccessKey != want {
+		t.Errorf("expected secret access key %s, got %s", want, secretAccessKey)
+	}
+}
+
+func TestR2Endpoint(t *testing.T) {
+	got := r2Endpoint("abc123")
+	want := "https://abc123.r2.cloudflarestorage.com"
+	if got != want {
+		t.Errorf("expected %s, got %s", want, got)
+	}
+}
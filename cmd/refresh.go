@@ -0,0 +1,118 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/cloudflare/cloudflare-go/v6"
+	log "github.com/sirupsen/logrus"
+)
+
+// refreshRetryInterval is how long to wait before trying again when minting a
+// replacement token fails.
+const refreshRetryInterval = 30 * time.Second
+
+// defaultRefreshBefore returns how long before expiry a token is replaced when
+// --refresh-before isn't set: a fifth of the session, up to five minutes.
+func defaultRefreshBefore(sessionDuration time.Duration) time.Duration {
+	before := sessionDuration / 5
+	if before > 5*time.Minute {
+		before = 5 * time.Minute
+	}
+	return before
+}
+
+// tokenRefresher replaces a short lived token shortly before it expires for as
+// long as the `exec` session is running.
+type tokenRefresher struct {
+	client        *cloudflare.Client
+	profile       profile
+	profileName   string
+	dir           string
+	refreshBefore time.Duration
+	current       shortLivedToken
+	// commandLine is the redacted command line recorded in the audit log.
+	commandLine []string
+}
+
+// tokenFile is the file containing the current short lived token.
+func (r *tokenRefresher) tokenFile() string {
+	return filepath.Join(r.dir, "token")
+}
+
+// expiryFile is the file containing the Unix timestamp the current short lived
+// token expires at.
+func (r *tokenRefresher) expiryFile() string {
+	return filepath.Join(r.dir, "expiry")
+}
+
+// writeFiles writes the current token and its expiry to their files.
+func (r *tokenRefresher) writeFiles() error {
+	if err := writeSecretFile(r.tokenFile(), r.current.Value); err != nil {
+		return err
+	}
+	return writeSecretFile(r.expiryFile(), strconv.FormatInt(r.current.ExpiresOn.Unix(), 10))
+}
+
+// replace makes token the current token, updating the token and expiry files
+// as well as any secret files written with --secrets-as-files.
+func (r *tokenRefresher) replace(token shortLivedToken) error {
+	_, oldR2Secret := r2Credentials(r.current.ID, r.current.Value)
+	_, newR2Secret := r2Credentials(token.ID, token.Value)
+
+	replacements := map[string]string{
+		r.current.Value: token.Value,
+		oldR2Secret:     newR2Secret,
+	}
+
+	r.current = token
+	if err := r.writeFiles(); err != nil {
+		return err
+	}
+	return replaceSecretFiles(r.dir, replacements)
+}
+
+// run mints a replacement token refreshBefore the current one expires until
+// ctx is cancelled.
+func (r *tokenRefresher) run(ctx context.Context) {
+	next := r.current.ExpiresOn.Add(-r.refreshBefore)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Until(next)):
+		}
+
+		token, err := createShortLivedToken(ctx, r.client, r.profileName, r.profile)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			fmt.Fprintf(os.Stderr, "\n%s: failed to refresh the short lived token for %q, retrying in %s: %s\n", projectName, r.profileName, refreshRetryInterval, err)
+			next = time.Now().Add(refreshRetryInterval)
+			continue
+		}
+
+		appendAuditRecord(auditRecord{
+			Event:          auditEventTokenMint,
+			Profile:        r.profileName,
+			Command:        r.commandLine,
+			TokenID:        token.ID,
+			TokenExpiresOn: &token.ExpiresOn,
+		})
+
+		if err := r.replace(token); err != nil {
+			fmt.Fprintf(os.Stderr, "\n%s: failed to write the refreshed token for %q: %s\n", projectName, r.profileName, err)
+		} else {
+			log.Debugf("refreshed token, new token %s expires at %s", token.ID, token.ExpiresOn)
+			fmt.Fprintf(os.Stderr, "\n%s: refreshed the short lived token for %q, it now expires at %s\n", projectName, r.profileName, token.ExpiresOn.Local().Format(time.Kitchen))
+		}
+
+		next = r.current.ExpiresOn.Add(-r.refreshBefore)
+	}
+}
@@ -0,0 +1,24 @@
+package cmd
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDefaultRefreshBefore(t *testing.T) {
+	tests := []struct {
+		session time.Duration
+		want    time.Duration
+	}{
+		{10 * time.Minute, 2 * time.Minute},
+		{15 * time.Minute, 3 * time.Minute},
+		{time.Hour, 5 * time.Minute},
+		{12 * time.Hour, 5 * time.Minute},
+	}
+
+	for _, tt := range tests {
+		if got := defaultRefreshBefore(tt.session); got != tt.want {
+			t.Errorf("defaultRefreshBefore(%s) = %s, want %s", tt.session, got, tt.want)
+		}
+	}
+}
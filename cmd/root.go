@@ -1,8 +1,10 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
 	"os"
+	"time"
 
 	"github.com/99designs/keyring"
 	log "github.com/sirupsen/logrus"
@@ -12,6 +14,7 @@ import (
 
 var (
 	verbose                  bool
+	allowInsecurePermissions bool
 	projectName              = "cf-vault"
 	projectNameWithoutHyphen = "cfvault"
 )
@@ -30,6 +33,10 @@ var keyringDefaults = keyring.Config{
 var rootCmd = &cobra.Command{
 	Use:  projectName,
 	Long: "Manage your Cloudflare credentials, securely",
+	// Errors are logged by Execute so they look the same whichever command
+	// returned them.
+	SilenceErrors: true,
+	SilenceUsage:  true,
 	PreRun: func(cmd *cobra.Command, args []string) {
 		if verbose {
 			log.SetLevel(log.DebugLevel)
@@ -62,19 +69,84 @@ func init() {
 	log.SetLevel(log.WarnLevel)
 
 	rootCmd.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "increase the verbosity of the output")
+	rootCmd.PersistentFlags().BoolVarP(&allowInsecurePermissions, "allow-insecure-permissions", "", false, "run even when the config or keyring files are accessible by group or others")
+	rootCmd.PersistentFlags().StringVarP(&outputFormat, "output", "o", outputTable, "output format of list, status, doctor, audit and audit verify (table, json or yaml)")
 
 	var profileTemplate string
 	var sessionDuration string
 	addCmd.Flags().StringVarP(&profileTemplate, "profile-template", "", "", "create profile with a predefined permissions and resources template")
 	addCmd.Flags().StringVarP(&sessionDuration, "session-duration", "", "", "TTL of short lived tokens requests")
+	var accountID string
+	var tokenOwner string
+	addCmd.Flags().StringVarP(&accountID, "account-id", "", "", "account ID the profile is associated with")
+	var enableTOTP bool
+	addCmd.Flags().BoolVarP(&enableTOTP, "enable-totp", "", false, "require a TOTP code from an authenticator app to use the profile")
+	addCmd.Flags().StringVarP(&tokenOwner, "token-owner", "", "", "owner of short lived tokens, either \"user\" (default) or \"account\"")
+
+	var execR2Credentials bool
+	execCmd.Flags().BoolVarP(&execR2Credentials, "r2-credentials", "", false, "export S3 compatible R2 credentials derived from the short lived token")
+	var execSecretsAsFiles bool
+	execCmd.Flags().BoolVarP(&execSecretsAsFiles, "secrets-as-files", "", false, "pass secrets to the command as files referenced by *_FILE variables instead of environment variables")
+	var execCleanEnv bool
+	execCmd.Flags().BoolVarP(&execCleanEnv, "clean-env", "", false, "pass only a minimal base environment (HOME, PATH, SHELL, TERM, etc.) to the command")
+	var execYes bool
+	execCmd.Flags().BoolVarP(&execYes, "yes", "y", false, "confirm profiles with require_confirmation set without prompting")
+	var execTOTPCode string
+	execCmd.Flags().StringVarP(&execTOTPCode, "totp-code", "", "", "TOTP code for profiles with totp enabled, prompted for when not set")
+	var execBreakGlass bool
+	var execReason string
+	execCmd.Flags().BoolVarP(&execBreakGlass, "break-glass", "", false, "use the profile outside of its allowed_window, requires --reason")
+	execCmd.Flags().StringVarP(&execReason, "reason", "", "", "why --break-glass is needed, recorded in the audit log")
+	var execRefresh bool
+	execCmd.Flags().BoolVarP(&execRefresh, "refresh", "", false, "replace the short lived token before it expires for as long as the command runs")
+	var execRefreshBefore time.Duration
+	execCmd.Flags().DurationVarP(&execRefreshBefore, "refresh-before", "", 0, "how long before expiry to refresh the short lived token (default a fifth of the session duration, at most 5m)")
+
+	var execDuration time.Duration
+	execCmd.Flags().DurationVarP(&execDuration, "duration", "", 0, "override the profile's session_duration, clamped to its max_session_duration")
+
+	var doctorFix bool
+	doctorCmd.Flags().BoolVarP(&doctorFix, "fix", "", false, "remove group and world access from the config and keyring files")
+
+	var statusVerify bool
+	statusCmd.Flags().BoolVarP(&statusVerify, "verify", "", false, "check the session's API token with Cloudflare")
+
+	var promptInit string
+	var promptShell string
+	var promptNoColour bool
+	promptCmd.Flags().StringVarP(&promptInit, "init", "", "", "print the snippet which adds the session to the prompt of a shell (bash, zsh or fish)")
+	promptCmd.Flags().StringVarP(&promptShell, "shell", "", "", "shell the prompt is rendered for, used to mark colour codes as zero width (bash, zsh or fish)")
+	promptCmd.Flags().BoolVarP(&promptNoColour, "no-color", "", false, "don't colour the prompt by the time left in the session")
+
+	var auditProfile string
+	var auditUser string
+	var auditEvent string
+	var auditSince time.Duration
+	auditCmd.Flags().StringVarP(&auditProfile, "profile", "", "", "only show records for this profile")
+	auditCmd.Flags().StringVarP(&auditUser, "user", "", "", "only show records for this OS user")
+	auditCmd.Flags().StringVarP(&auditEvent, "event", "", "", "only show records of this event (add, exec, token_mint or break_glass)")
+	auditCmd.Flags().DurationVarP(&auditSince, "since", "", 0, "only show records from within this long ago, e.g. 24h")
+
+	auditCmd.AddCommand(auditVerifyCmd)
 
 	rootCmd.AddCommand(addCmd)
 	rootCmd.AddCommand(listCmd)
 	rootCmd.AddCommand(execCmd)
 	rootCmd.AddCommand(versionCmd)
+	rootCmd.AddCommand(doctorCmd)
+	rootCmd.AddCommand(statusCmd)
+	rootCmd.AddCommand(promptCmd)
+	rootCmd.AddCommand(auditCmd)
 }
 
-// Execute is the main entrypoint for the CLI.
+// Execute is the main entrypoint for the CLI. Errors are logged before being
+// returned, use ExitCode to find the code to exit with.
 func Execute() error {
-	return rootCmd.Execute()
+	err := rootCmd.Execute()
+
+	var statusErr *exitStatusError
+	if err != nil && !errors.As(err, &statusErr) {
+		log.Error(err)
+	}
+	return err
 }
@@ -0,0 +1,66 @@
+package cmd
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+)
+
+// forwardedSignals are relayed from cf-vault to the child process while it
+// runs.
+var forwardedSignals = []os.Signal{syscall.SIGTERM, syscall.SIGHUP}
+
+// terminalSignals are sent by the terminal to the whole foreground process
+// group, which includes the child, so they are caught to keep cf-vault alive
+// but not forwarded. Tools such as Terraform abort immediately on a second
+// SIGINT. They aren't ignored as ignored signals stay ignored in the child.
+var terminalSignals = []os.Signal{os.Interrupt, syscall.SIGQUIT}
+
+// runCommand runs the executable at path as a child process attached to the
+// current terminal and returns its exit code, 128 plus the signal number when
+// it was killed by a signal as shells report it. Unlike syscall.Exec, cf-vault
+// remains the parent so it can clean up after the child exits.
+func runCommand(path string, args []string, env []string) (int, error) {
+	c := exec.Command(path)
+	c.Args = args
+	c.Env = env
+	c.Stdin = os.Stdin
+	c.Stdout = os.Stdout
+	c.Stderr = os.Stderr
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, append(forwardedSignals, terminalSignals...)...)
+	defer signal.Stop(sigs)
+
+	if err := c.Start(); err != nil {
+		return 1, err
+	}
+
+	go func() {
+		for sig := range sigs {
+			if sig == os.Interrupt || sig == syscall.SIGQUIT {
+				continue
+			}
+			c.Process.Signal(sig)
+		}
+	}()
+
+	err := c.Wait()
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		if code := exitErr.ExitCode(); code >= 0 {
+			return code, nil
+		}
+		if status, ok := exitErr.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+			return 128 + int(status.Signal()), nil
+		}
+		return 1, nil
+	}
+	if err != nil {
+		return 1, err
+	}
+	return 0, nil
+}
@@ -0,0 +1,114 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// secretsBaseDir returns the directory in which the private secrets directory
+// is created. /dev/shm is preferred as it is memory backed on Linux so the
+// secrets never touch the disk.
+func secretsBaseDir() string {
+	if info, err := os.Stat("/dev/shm"); err == nil && info.IsDir() {
+		return "/dev/shm"
+	}
+	return os.TempDir()
+}
+
+// newSecretsDir creates a private directory for secret files. The caller must
+// remove it once the secrets are no longer needed.
+func newSecretsDir() (string, error) {
+	dir, err := os.MkdirTemp(secretsBaseDir(), projectName+"-")
+	if err != nil {
+		return "", fmt.Errorf("failed to create secrets directory: %w", err)
+	}
+	if err := os.Chmod(dir, 0700); err != nil {
+		os.RemoveAll(dir)
+		return "", err
+	}
+	return dir, nil
+}
+
+// writeSecretFile atomically replaces the contents of a secret file so readers
+// never observe a partially written value.
+func writeSecretFile(path, value string) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+"-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := tmp.Chmod(0600); err != nil {
+		tmp.Close()
+		return err
+	}
+	if _, err := tmp.WriteString(value); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// writeSecretFiles writes every variable in vars whose value is one of the
+// secrets to its own file in dir. The variable is replaced by one with a
+// `_FILE` suffix pointing at the file. It returns the names of the variables
+// that were replaced.
+func writeSecretFiles(dir string, vars *environ, secrets []string) ([]string, error) {
+	isSecret := map[string]bool{}
+	for _, s := range secrets {
+		if s != "" {
+			isSecret[s] = true
+		}
+	}
+
+	var replaced []string
+	for _, kv := range append(environ{}, *vars...) {
+		key, value, _ := strings.Cut(kv, "=")
+		if !isSecret[value] {
+			continue
+		}
+
+		path := filepath.Join(dir, key)
+		if err := writeSecretFile(path, value); err != nil {
+			return nil, fmt.Errorf("failed to write secret file for %s: %w", key, err)
+		}
+
+		vars.Unset(key)
+		vars.Set(key+"_FILE", path)
+		replaced = append(replaced, key)
+	}
+
+	return replaced, nil
+}
+
+// replaceSecretFiles rewrites every file in dir whose contents is a key of
+// replacements with the corresponding value.
+func replaceSecretFiles(dir string, replacements map[string]string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	for _, e := range entries {
+		if !e.Type().IsRegular() {
+			continue
+		}
+
+		path := filepath.Join(dir, e.Name())
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if newValue, ok := replacements[string(data)]; ok {
+			if err := writeSecretFile(path, newValue); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
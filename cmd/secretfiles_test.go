@@ -0,0 +1,95 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteSecretFiles(t *testing.T) {
+	vars := environ{
+		"CLOUDFLARE_API_TOKEN=s3cr3t",
+		"CF_API_TOKEN=s3cr3t",
+		"CLOUDFLARE_ACCOUNT_ID=abc",
+	}
+
+	dir, err := newSecretsDir()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	replaced, err := writeSecretFiles(dir, &vars, []string{"s3cr3t"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(replaced) != 2 {
+		t.Errorf("expected 2 variables to be replaced, got %v", replaced)
+	}
+
+	info, err := os.Stat(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0700 {
+		t.Errorf("expected secrets directory mode 0700, got %04o", info.Mode().Perm())
+	}
+
+	path, ok := vars.Get("CLOUDFLARE_API_TOKEN_FILE")
+	if !ok {
+		t.Fatalf("expected CLOUDFLARE_API_TOKEN_FILE to be set, got %v", []string(vars))
+	}
+	if filepath.Dir(path) != dir {
+		t.Errorf("expected secret file inside %s, got %s", dir, path)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "s3cr3t" {
+		t.Errorf("expected secret file to contain the secret, got %q", data)
+	}
+	fileInfo, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fileInfo.Mode().Perm() != 0600 {
+		t.Errorf("expected secret file mode 0600, got %04o", fileInfo.Mode().Perm())
+	}
+
+	if _, ok := vars.Get("CLOUDFLARE_API_TOKEN"); ok {
+		t.Error("expected CLOUDFLARE_API_TOKEN to be removed")
+	}
+	if v, ok := vars.Get("CLOUDFLARE_ACCOUNT_ID"); !ok || v != "abc" {
+		t.Error("expected non-secret CLOUDFLARE_ACCOUNT_ID to be left alone")
+	}
+}
+
+func TestReplaceSecretFiles(t *testing.T) {
+	dir := t.TempDir()
+	for name, value := range map[string]string{"token": "old", "other": "unchanged"} {
+		if err := writeSecretFile(filepath.Join(dir, name), value); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := replaceSecretFiles(dir, map[string]string{"old": "new"}); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, want := range map[string]string{"token": "new", "other": "unchanged"} {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != want {
+			t.Errorf("expected %s to contain %q, got %q", name, want, data)
+		}
+	}
+
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 2 {
+		t.Errorf("expected no temporary files to be left behind, got %d entries", len(entries))
+	}
+}
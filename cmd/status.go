@@ -0,0 +1,271 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cloudflare/cloudflare-go/v6"
+	"github.com/cloudflare/cloudflare-go/v6/accounts"
+	"github.com/cloudflare/cloudflare-go/v6/option"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// sessionStatus describes the `exec` session the current shell is running in.
+type sessionStatus struct {
+	Profile    string    `json:"profile" yaml:"profile"`
+	AuthType   string    `json:"auth_type" yaml:"auth_type"`
+	TokenOwner string    `json:"token_owner,omitempty" yaml:"token_owner,omitempty"`
+	ExpiresAt  time.Time `json:"expires_at,omitzero" yaml:"expires_at,omitempty"`
+	Expired    bool      `json:"expired" yaml:"expired"`
+	Policies   []string  `json:"policies,omitempty" yaml:"policies,omitempty"`
+	// TokenStatus and TokenError are the result of checking the API token
+	// with --verify.
+	TokenStatus string `json:"token_status,omitempty" yaml:"token_status,omitempty"`
+	TokenError  string `json:"token_error,omitempty" yaml:"token_error,omitempty"`
+}
+
+var statusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show the cf-vault session of the current shell",
+	Long:  "",
+	Example: `
+  Show the active profile and how long its credentials remain valid
+
+    $ cf-vault status
+
+  Also check the API token with Cloudflare
+
+    $ cf-vault status --verify
+`,
+	PreRun: func(cmd *cobra.Command, args []string) {
+		if verbose {
+			log.SetLevel(log.DebugLevel)
+		}
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		verify, _ := cmd.Flags().GetBool("verify")
+
+		format, err := resolveOutputFormat()
+		if err != nil {
+			return err
+		}
+
+		profileName := os.Getenv("CLOUDFLARE_VAULT_SESSION")
+		if profileName == "" {
+			return errors.New("not in a cf-vault session, CLOUDFLARE_VAULT_SESSION is not set")
+		}
+
+		configDir, err := resolveConfigDir()
+		if err != nil {
+			return err
+		}
+		configPath := filepath.Join(configDir, "config.toml")
+
+		if err := verifyPermissions(configDir); err != nil {
+			return err
+		}
+
+		config, err := readConfig(configPath)
+		if err != nil {
+			return err
+		}
+
+		profile, ok := config.Profiles[profileName]
+		if !ok {
+			return &profileNotFoundError{profile: profileName, configPath: configPath}
+		}
+
+		status, err := currentSessionStatus(profileName, profile, time.Now())
+		if err != nil {
+			return err
+		}
+
+		// Expired sessions aren't worth checking with the API.
+		var verifyErr error
+		if verify && !status.Expired {
+			status.TokenStatus, verifyErr = verifySessionToken(context.Background(), profile)
+			if verifyErr != nil {
+				status.TokenError = verifyErr.Error()
+			}
+		}
+
+		if format != outputTable {
+			if err := writeStructured(os.Stdout, format, status); err != nil {
+				return err
+			}
+		} else {
+			fmt.Printf("Profile:     %s\n", status.Profile)
+			fmt.Printf("Auth type:   %s\n", status.AuthType)
+			if status.TokenOwner != "" {
+				fmt.Printf("Token owner: %s\n", status.TokenOwner)
+			}
+			fmt.Printf("Expires:     %s\n", formatExpiry(status.ExpiresAt, time.Now()))
+			if len(status.Policies) > 0 {
+				fmt.Println("Policies:")
+				for _, p := range status.Policies {
+					fmt.Printf("  %s\n", p)
+				}
+			}
+			if verifyErr != nil {
+				fmt.Printf("Token:       %s\n", verifyErr)
+			} else if status.TokenStatus != "" {
+				fmt.Printf("Token:       %s\n", status.TokenStatus)
+			}
+		}
+
+		switch {
+		case status.Expired:
+			return &exitStatusError{code: exitError}
+		case verifyErr != nil:
+			return &exitStatusError{code: ExitCode(classifyAPIError(verifyErr))}
+		case verify && status.TokenStatus != "active":
+			return &exitStatusError{code: exitAPIAuthFailure}
+		}
+
+		return nil
+	},
+}
+
+// currentSessionStatus builds the status of the session from the profile and
+// the variables exported by `exec`.
+func currentSessionStatus(profileName string, p profile, now time.Time) (sessionStatus, error) {
+	status := sessionStatus{
+		Profile:  profileName,
+		AuthType: p.AuthType,
+		Policies: policySummary(p.Policies),
+	}
+	if p.SessionDuration != "" {
+		status.TokenOwner = p.TokenOwner
+		if status.TokenOwner == "" {
+			status.TokenOwner = "user"
+		}
+	}
+
+	expiresAt, err := sessionExpiry()
+	if err != nil {
+		return sessionStatus{}, err
+	}
+	if !expiresAt.IsZero() {
+		status.ExpiresAt = expiresAt
+		status.Expired = !now.Before(expiresAt)
+	}
+
+	return status, nil
+}
+
+// sessionExpiry returns when the current session's credentials expire or the
+// zero time if they don't. The expiry file written by --refresh is preferred
+// over CLOUDFLARE_SESSION_EXPIRY as it tracks refreshed tokens.
+func sessionExpiry() (time.Time, error) {
+	expiry := os.Getenv("CLOUDFLARE_SESSION_EXPIRY")
+	if path := os.Getenv("CLOUDFLARE_VAULT_EXPIRY_FILE"); path != "" {
+		if data, err := os.ReadFile(path); err == nil {
+			expiry = strings.TrimSpace(string(data))
+		} else {
+			log.Debugf("failed to read expiry file %s: %s", path, err)
+		}
+	}
+
+	if expiry == "" {
+		return time.Time{}, nil
+	}
+
+	unix, err := strconv.ParseInt(expiry, 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid session expiry %q: %w", expiry, err)
+	}
+	return time.Unix(unix, 0), nil
+}
+
+// formatExpiry describes when the session expires relative to now.
+func formatExpiry(expiresAt, now time.Time) string {
+	if expiresAt.IsZero() {
+		return "never (static credentials)"
+	}
+
+	at := expiresAt.Local().Format(time.RFC3339)
+	if !now.Before(expiresAt) {
+		return fmt.Sprintf("%s (expired %s ago)", at, now.Sub(expiresAt).Truncate(time.Second))
+	}
+	return fmt.Sprintf("%s (in %s)", at, expiresAt.Sub(now).Truncate(time.Second))
+}
+
+// policySummary describes each policy on a single line as its effect,
+// permission groups and resources.
+func policySummary(policies []policy) []string {
+	var summary []string
+	for _, p := range policies {
+		var groups []string
+		for _, g := range p.PermissionGroups {
+			if g.Name != "" {
+				groups = append(groups, g.Name)
+			} else {
+				groups = append(groups, g.ID)
+			}
+		}
+
+		var resources []string
+		for r := range p.Resources {
+			resources = append(resources, r)
+		}
+		sort.Strings(resources)
+
+		summary = append(summary, fmt.Sprintf("%s %s on %s", p.Effect, strings.Join(groups, ", "), strings.Join(resources, ", ")))
+	}
+	return summary
+}
+
+// sessionToken returns the API token exported to the current session,
+// preferring the token file kept up to date by --refresh.
+func sessionToken() string {
+	for _, name := range []string{"CLOUDFLARE_VAULT_TOKEN_FILE", "CLOUDFLARE_API_TOKEN_FILE", "CF_API_TOKEN_FILE"} {
+		if path := os.Getenv(name); path != "" {
+			if data, err := os.ReadFile(path); err == nil {
+				return strings.TrimSpace(string(data))
+			}
+		}
+	}
+	for _, name := range []string{"CLOUDFLARE_API_TOKEN", "CF_API_TOKEN"} {
+		if v := os.Getenv(name); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// verifySessionToken checks the session's API token with Cloudflare and
+// returns its status.
+func verifySessionToken(ctx context.Context, p profile) (string, error) {
+	token := sessionToken()
+	if token == "" {
+		return "", errors.New("no API token found in the session, only API tokens can be verified")
+	}
+
+	client := cloudflare.NewClient(option.WithAPIToken(token))
+
+	if p.SessionDuration != "" && p.TokenOwner == "account" {
+		accountID := os.Getenv("CLOUDFLARE_ACCOUNT_ID")
+		if accountID == "" {
+			accountID = p.AccountID
+		}
+		res, err := client.Accounts.Tokens.Verify(ctx, accounts.TokenVerifyParams{AccountID: cloudflare.F(accountID)})
+		if err != nil {
+			return "", fmt.Errorf("failed to verify token: %w", err)
+		}
+		return string(res.Status), nil
+	}
+
+	res, err := client.User.Tokens.Verify(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to verify token: %w", err)
+	}
+	return string(res.Status), nil
+}
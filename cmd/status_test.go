@@ -0,0 +1,114 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCurrentSessionStatus(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	p := profile{AuthType: "api_token", SessionDuration: "15m", Policies: validPolicies()}
+
+	t.Setenv("CLOUDFLARE_SESSION_EXPIRY", "1700000060")
+	t.Setenv("CLOUDFLARE_VAULT_EXPIRY_FILE", "")
+
+	status, err := currentSessionStatus("work", p, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Expired {
+		t.Error("expected session not to have expired")
+	}
+	if status.TokenOwner != "user" {
+		t.Errorf("expected token owner to default to user, got %q", status.TokenOwner)
+	}
+	if !status.ExpiresAt.Equal(time.Unix(1700000060, 0)) {
+		t.Errorf("unexpected expiry %s", status.ExpiresAt)
+	}
+
+	status, err = currentSessionStatus("work", p, now.Add(2*time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !status.Expired {
+		t.Error("expected session to have expired")
+	}
+}
+
+func TestCurrentSessionStatusPrefersExpiryFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "expiry")
+	if err := os.WriteFile(path, []byte("1700000600"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("CLOUDFLARE_SESSION_EXPIRY", "1700000060")
+	t.Setenv("CLOUDFLARE_VAULT_EXPIRY_FILE", path)
+
+	status, err := currentSessionStatus("work", profile{AuthType: "api_token"}, time.Unix(1700000000, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !status.ExpiresAt.Equal(time.Unix(1700000600, 0)) {
+		t.Errorf("expected expiry from the file, got %s", status.ExpiresAt)
+	}
+}
+
+func TestCurrentSessionStatusInvalidExpiry(t *testing.T) {
+	t.Setenv("CLOUDFLARE_SESSION_EXPIRY", "soon")
+	t.Setenv("CLOUDFLARE_VAULT_EXPIRY_FILE", "")
+
+	if _, err := currentSessionStatus("work", profile{AuthType: "api_token"}, time.Now()); err == nil {
+		t.Error("expected an error for a non-numeric expiry")
+	}
+}
+
+func TestSessionStatusStaticCredentialsOmitExpiry(t *testing.T) {
+	status := sessionStatus{Profile: "work", AuthType: "api_token"}
+
+	for _, format := range []string{outputJSON, outputYAML} {
+		var buf bytes.Buffer
+		if err := writeStructured(&buf, format, status); err != nil {
+			t.Fatal(err)
+		}
+		if strings.Contains(buf.String(), "expires_at") {
+			t.Errorf("expected no expires_at in %s for static credentials, got:\n%s", format, buf.String())
+		}
+	}
+}
+
+func TestFormatExpiry(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+
+	if got := formatExpiry(time.Time{}, now); got != "never (static credentials)" {
+		t.Errorf("unexpected static credential expiry %q", got)
+	}
+	if got := formatExpiry(now.Add(90*time.Second), now); !strings.HasSuffix(got, "(in 1m30s)") {
+		t.Errorf("unexpected future expiry %q", got)
+	}
+	if got := formatExpiry(now.Add(-time.Minute), now); !strings.HasSuffix(got, "(expired 1m0s ago)") {
+		t.Errorf("unexpected past expiry %q", got)
+	}
+}
+
+func TestPolicySummary(t *testing.T) {
+	policies := []policy{{
+		Effect: "allow",
+		PermissionGroups: []permissionGroup{
+			{ID: "c8fed203ed3043cba015a93ad1616f1f", Name: "Zone Read"},
+			{ID: "82e64a83756745bbbb1c9c2701bf816b"},
+		},
+		Resources: map[string]interface{}{
+			"com.cloudflare.api.account.zone.*": "*",
+			"com.cloudflare.api.account.*":      "*",
+		},
+	}}
+
+	want := "allow Zone Read, 82e64a83756745bbbb1c9c2701bf816b on com.cloudflare.api.account.*, com.cloudflare.api.account.zone.*"
+	got := policySummary(policies)
+	if len(got) != 1 || got[0] != want {
+		t.Errorf("expected %q, got %v", want, got)
+	}
+}
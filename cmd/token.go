@@ -0,0 +1,149 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/cloudflare/cloudflare-go/v6"
+	"github.com/cloudflare/cloudflare-go/v6/accounts"
+	"github.com/cloudflare/cloudflare-go/v6/shared"
+	"github.com/cloudflare/cloudflare-go/v6/user"
+)
+
+// shortLivedToken is an API token minted for a single `exec` session.
+type shortLivedToken struct {
+	ID        string
+	Value     string
+	ExpiresOn time.Time
+}
+
+// createShortLivedToken mints a new API token using the profile's policies
+// which is valid from now until the session duration has elapsed. Tokens are
+// owned by the user unless the profile's token_owner is "account" and are
+// named using the profile's token_name_template.
+func createShortLivedToken(ctx context.Context, client *cloudflare.Client, profileName string, p profile) (shortLivedToken, error) {
+	parsedSessionDuration, err := time.ParseDuration(p.SessionDuration)
+	if err != nil {
+		return shortLivedToken{}, err
+	}
+	now, _ := time.Parse(time.RFC3339, time.Now().UTC().Format(time.RFC3339))
+	tokenExpiry := now.Add(time.Second * time.Duration(parsedSessionDuration.Seconds()))
+	tokenName := renderTokenName(p.TokenNameTemplate, profileName, tokenExpiry)
+	tokenPolicies := tokenPolicyParams(p.Policies)
+
+	if p.TokenOwner == "account" {
+		params := accounts.TokenNewParams{
+			AccountID: cloudflare.F(p.AccountID),
+			Name:      cloudflare.F(tokenName),
+			NotBefore: cloudflare.F(now),
+			ExpiresOn: cloudflare.F(tokenExpiry),
+			Policies:  cloudflare.F(tokenPolicies),
+		}
+		if len(p.AllowedIPs) > 0 || len(p.DeniedIPs) > 0 {
+			requestIP := accounts.TokenNewParamsConditionRequestIP{}
+			if len(p.AllowedIPs) > 0 {
+				requestIP.In = cloudflare.F(p.AllowedIPs)
+			}
+			if len(p.DeniedIPs) > 0 {
+				requestIP.NotIn = cloudflare.F(p.DeniedIPs)
+			}
+			params.Condition = cloudflare.F(accounts.TokenNewParamsCondition{RequestIP: cloudflare.F(requestIP)})
+		}
+
+		token, err := client.Accounts.Tokens.New(ctx, params)
+		if err != nil {
+			return shortLivedToken{}, classifyTokenError(err)
+		}
+		return shortLivedToken{ID: token.ID, Value: token.Value, ExpiresOn: tokenExpiry}, nil
+	}
+
+	params := user.TokenNewParams{
+		Name:      cloudflare.F(tokenName),
+		NotBefore: cloudflare.F(now),
+		ExpiresOn: cloudflare.F(tokenExpiry),
+		Policies:  cloudflare.F(tokenPolicies),
+	}
+	if len(p.AllowedIPs) > 0 || len(p.DeniedIPs) > 0 {
+		requestIP := user.TokenNewParamsConditionRequestIP{}
+		if len(p.AllowedIPs) > 0 {
+			requestIP.In = cloudflare.F(p.AllowedIPs)
+		}
+		if len(p.DeniedIPs) > 0 {
+			requestIP.NotIn = cloudflare.F(p.DeniedIPs)
+		}
+		params.Condition = cloudflare.F(user.TokenNewParamsCondition{RequestIP: cloudflare.F(requestIP)})
+	}
+
+	token, err := client.User.Tokens.New(ctx, params)
+	if err != nil {
+		return shortLivedToken{}, classifyTokenError(err)
+	}
+	return shortLivedToken{ID: token.ID, Value: token.Value, ExpiresOn: tokenExpiry}, nil
+}
+
+// deleteShortLivedToken deletes a token minted by createShortLivedToken for the
+// profile, used when the session is abandoned before the command starts.
+func deleteShortLivedToken(ctx context.Context, client *cloudflare.Client, p profile, tokenID string) error {
+	if p.TokenOwner == "account" {
+		_, err := client.Accounts.Tokens.Delete(ctx, tokenID, accounts.TokenDeleteParams{AccountID: cloudflare.F(p.AccountID)})
+		return err
+	}
+	_, err := client.User.Tokens.Delete(ctx, tokenID)
+	return err
+}
+
+// tokenPolicyParams converts the configured policies into their API request
+// representation.
+func tokenPolicyParams(policies []policy) []shared.TokenPolicyParam {
+	tokenPolicies := []shared.TokenPolicyParam{}
+	for _, p := range policies {
+		var groups []shared.TokenPolicyPermissionGroupParam
+		for _, g := range p.PermissionGroups {
+			groups = append(groups, shared.TokenPolicyPermissionGroupParam{
+				ID: cloudflare.F(g.ID),
+			})
+		}
+		tokenPolicies = append(tokenPolicies, shared.TokenPolicyParam{
+			Effect:           cloudflare.F(shared.TokenPolicyEffect(p.Effect)),
+			PermissionGroups: cloudflare.F(groups),
+			Resources:        cloudflare.F(tokenPolicyResources(p.Resources)),
+		})
+	}
+	return tokenPolicies
+}
+
+// tokenPolicyResources converts policy resources into either the flat
+// (`"resource" = "*"`) or nested (`"account" = { "zone.*" = "*" }`) form.
+func tokenPolicyResources(resources map[string]interface{}) shared.TokenPolicyResourcesUnionParam {
+	nested := false
+	for _, v := range resources {
+		if _, ok := v.(map[string]interface{}); ok {
+			nested = true
+		}
+	}
+
+	if nested {
+		out := shared.TokenPolicyResourcesIAMResourcesTypeObjectNestedParam{}
+		for k, v := range resources {
+			inner := map[string]string{}
+			if m, ok := v.(map[string]interface{}); ok {
+				for ik, iv := range m {
+					inner[ik] = fmt.Sprintf("%v", iv)
+				}
+			}
+			out[k] = inner
+		}
+		return out
+	}
+
+	out := shared.TokenPolicyResourcesIAMResourcesTypeObjectStringParam{}
+	for k, v := range resources {
+		if s, ok := v.(string); ok {
+			out[k] = s
+		} else {
+			out[k] = fmt.Sprintf("%v", v)
+		}
+	}
+	return out
+}
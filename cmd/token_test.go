@@ -0,0 +1,210 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/cloudflare/cloudflare-go/v6/shared"
+)
+
+func TestTokenPolicyResources_Flat(t *testing.T) {
+	got := tokenPolicyResources(map[string]interface{}{"com.cloudflare.api.account.*": "*"})
+
+	flat, ok := got.(shared.TokenPolicyResourcesIAMResourcesTypeObjectStringParam)
+	if !ok {
+		t.Fatalf("expected flat resources, got %T", got)
+	}
+	if flat["com.cloudflare.api.account.*"] != "*" {
+		t.Errorf("unexpected resources: %v", flat)
+	}
+}
+
+func TestTokenPolicyResources_Nested(t *testing.T) {
+	got := tokenPolicyResources(map[string]interface{}{
+		"com.cloudflare.api.account.abc": map[string]interface{}{"com.cloudflare.api.account.zone.*": "*"},
+	})
+
+	nested, ok := got.(shared.TokenPolicyResourcesIAMResourcesTypeObjectNestedParam)
+	if !ok {
+		t.Fatalf("expected nested resources, got %T", got)
+	}
+	if nested["com.cloudflare.api.account.abc"]["com.cloudflare.api.account.zone.*"] != "*" {
+		t.Errorf("unexpected resources: %v", nested)
+	}
+}
+
+// newMockCreateTokenServer responds to token creation requests on path and
+// records whether it was called.
+func newMockCreateTokenServer(t *testing.T, path string, called *bool) *httptest.Server {
+	return newRecordingCreateTokenServer(t, path, called, nil)
+}
+
+// newRecordingCreateTokenServer is newMockCreateTokenServer which also decodes
+// the request body into body when it isn't nil.
+func newRecordingCreateTokenServer(t *testing.T, path string, called *bool, body *map[string]interface{}) *httptest.Server {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+		*called = true
+		if body != nil {
+			json.NewDecoder(r.Body).Decode(body)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success":  true,
+			"errors":   []interface{}{},
+			"messages": []interface{}{},
+			"result":   map[string]interface{}{"id": "token-id", "value": "token-value"},
+		})
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestCreateShortLivedToken_User(t *testing.T) {
+	var called bool
+	srv := newMockCreateTokenServer(t, "/user/tokens", &called)
+	client := newTestClient(t, srv.URL)
+
+	start := time.Now()
+	token, err := createShortLivedToken(context.Background(), client, "example", profile{
+		AuthType:        "api_token",
+		SessionDuration: "15m",
+		Policies:        validPolicies(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !called {
+		t.Fatal("expected the user tokens endpoint to be called")
+	}
+	if token.ID != "token-id" || token.Value != "token-value" {
+		t.Errorf("unexpected token: %+v", token)
+	}
+	if d := token.ExpiresOn.Sub(start); d < 14*time.Minute || d > 16*time.Minute {
+		t.Errorf("expected expiry ~15m from now, got %s", d)
+	}
+}
+
+func TestCreateShortLivedToken_Account(t *testing.T) {
+	var called bool
+	srv := newMockCreateTokenServer(t, "/accounts/acct-123/tokens", &called)
+	client := newTestClient(t, srv.URL)
+
+	token, err := createShortLivedToken(context.Background(), client, "example", profile{
+		AuthType:        "api_token",
+		SessionDuration: "15m",
+		AccountID:       "acct-123",
+		TokenOwner:      "account",
+		Policies:        validPolicies(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !called {
+		t.Fatal("expected the account tokens endpoint to be called")
+	}
+	if token.ID != "token-id" {
+		t.Errorf("unexpected token: %+v", token)
+	}
+}
+
+func TestDeleteShortLivedToken(t *testing.T) {
+	tests := map[string]struct {
+		profile profile
+		path    string
+	}{
+		"user":    {profile: profile{}, path: "/user/tokens/token-id"},
+		"account": {profile: profile{AccountID: "acct-123", TokenOwner: "account"}, path: "/accounts/acct-123/tokens/token-id"},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			var called bool
+			srv := newMockCreateTokenServer(t, tc.path, &called)
+
+			if err := deleteShortLivedToken(context.Background(), newTestClient(t, srv.URL), tc.profile, "token-id"); err != nil {
+				t.Fatal(err)
+			}
+			if !called {
+				t.Fatalf("expected %s to be called", tc.path)
+			}
+		})
+	}
+}
+
+func TestCreateShortLivedToken_IPCondition(t *testing.T) {
+	var called bool
+	var body map[string]interface{}
+	srv := newRecordingCreateTokenServer(t, "/user/tokens", &called, &body)
+	client := newTestClient(t, srv.URL)
+
+	_, err := createShortLivedToken(context.Background(), client, "example", profile{
+		AuthType:        "api_token",
+		SessionDuration: "15m",
+		AllowedIPs:      []string{"192.0.2.0/24"},
+		DeniedIPs:       []string{"192.0.2.1/32"},
+		Policies:        validPolicies(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	condition, _ := body["condition"].(map[string]interface{})
+	requestIP, _ := condition["request_ip"].(map[string]interface{})
+	in, _ := requestIP["in"].([]interface{})
+	notIn, _ := requestIP["not_in"].([]interface{})
+	if len(in) != 1 || in[0] != "192.0.2.0/24" {
+		t.Errorf("expected request_ip.in to be [192.0.2.0/24], got %v", requestIP["in"])
+	}
+	if len(notIn) != 1 || notIn[0] != "192.0.2.1/32" {
+		t.Errorf("expected request_ip.not_in to be [192.0.2.1/32], got %v", requestIP["not_in"])
+	}
+}
+
+func TestCreateShortLivedToken_Name(t *testing.T) {
+	var called bool
+	var body map[string]interface{}
+	srv := newRecordingCreateTokenServer(t, "/user/tokens", &called, &body)
+	client := newTestClient(t, srv.URL)
+
+	token, err := createShortLivedToken(context.Background(), client, "example", profile{
+		AuthType:          "api_token",
+		SessionDuration:   "15m",
+		TokenNameTemplate: "deploy-{profile}-{expiry}",
+		Policies:          validPolicies(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := fmt.Sprintf("deploy-example-%d", token.ExpiresOn.Unix())
+	if body["name"] != want {
+		t.Errorf("expected token name %q, got %v", want, body["name"])
+	}
+}
+
+func TestCreateShortLivedToken_NoIPCondition(t *testing.T) {
+	var called bool
+	var body map[string]interface{}
+	srv := newRecordingCreateTokenServer(t, "/user/tokens", &called, &body)
+	client := newTestClient(t, srv.URL)
+
+	_, err := createShortLivedToken(context.Background(), client, "example", profile{
+		AuthType:        "api_token",
+		SessionDuration: "15m",
+		Policies:        validPolicies(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := body["condition"]; ok {
+		t.Errorf("expected no condition, got %v", body["condition"])
+	}
+}
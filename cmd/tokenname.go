@@ -0,0 +1,79 @@
+package cmd
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// defaultTokenNameTemplate names short lived tokens after the profile, user
+// and machine they were minted for so they can be traced from the dashboard.
+const defaultTokenNameTemplate = "cf-vault-{profile}-{user}@{hostname}-{expiry}"
+
+// tokenNamePlaceholder matches the {variable} placeholders in a
+// token_name_template.
+var tokenNamePlaceholder = regexp.MustCompile(`\{([^{}]*)\}`)
+
+// tokenNameVariables are the placeholders a token_name_template can use.
+var tokenNameVariables = map[string]bool{
+	"profile":  true,
+	"user":     true,
+	"hostname": true,
+	"expiry":   true,
+	"random":   true,
+}
+
+// validateTokenNameTemplate checks a token_name_template only uses known
+// placeholders. An empty value falls back to the default.
+func validateTokenNameTemplate(tmpl string) error {
+	for _, m := range tokenNamePlaceholder.FindAllStringSubmatch(tmpl, -1) {
+		if !tokenNameVariables[m[1]] {
+			return fmt.Errorf("token_name_template: unknown placeholder %q, valid placeholders: {profile}, {user}, {hostname}, {expiry} and {random}", m[0])
+		}
+	}
+	return nil
+}
+
+// tokenNameTemplate returns the template short lived tokens for the profile
+// are named with. The profile's setting takes precedence over the global one.
+func tokenNameTemplate(config tomlConfig, p profile) string {
+	if p.TokenNameTemplate != "" {
+		return p.TokenNameTemplate
+	}
+	if config.TokenNameTemplate != "" {
+		return config.TokenNameTemplate
+	}
+	return defaultTokenNameTemplate
+}
+
+// renderTokenName fills in the placeholders of a validated template. The
+// expiry is a Unix timestamp and each {random} is a fresh 6 character hex
+// string.
+func renderTokenName(tmpl, profileName string, expiry time.Time) string {
+	if tmpl == "" {
+		tmpl = defaultTokenNameTemplate
+	}
+
+	return tokenNamePlaceholder.ReplaceAllStringFunc(tmpl, func(placeholder string) string {
+		switch placeholder {
+		case "{profile}":
+			return profileName
+		case "{user}":
+			return currentUsername()
+		case "{hostname}":
+			hostname, _ := os.Hostname()
+			return hostname
+		case "{expiry}":
+			return strconv.FormatInt(expiry.Unix(), 10)
+		case "{random}":
+			b := make([]byte, 3)
+			rand.Read(b)
+			return hex.EncodeToString(b)
+		}
+		return placeholder
+	})
+}
@@ -0,0 +1,53 @@
+package cmd
+
+import (
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidateTokenNameTemplate(t *testing.T) {
+	for _, tmpl := range []string{"", defaultTokenNameTemplate, "ci-{profile}-{random}", "static-name"} {
+		if err := validateTokenNameTemplate(tmpl); err != nil {
+			t.Errorf("expected %q to be valid, got: %v", tmpl, err)
+		}
+	}
+
+	err := validateTokenNameTemplate("{profile}-{team}")
+	if err == nil || !strings.Contains(err.Error(), `unknown placeholder "{team}"`) {
+		t.Errorf("expected unknown placeholder error, got: %v", err)
+	}
+}
+
+func TestTokenNameTemplate(t *testing.T) {
+	if got := tokenNameTemplate(tomlConfig{}, profile{}); got != defaultTokenNameTemplate {
+		t.Errorf("expected the default template, got %q", got)
+	}
+	if got := tokenNameTemplate(tomlConfig{TokenNameTemplate: "global"}, profile{}); got != "global" {
+		t.Errorf("expected the global template, got %q", got)
+	}
+	if got := tokenNameTemplate(tomlConfig{TokenNameTemplate: "global"}, profile{TokenNameTemplate: "local"}); got != "local" {
+		t.Errorf("expected the profile template, got %q", got)
+	}
+}
+
+func TestRenderTokenName(t *testing.T) {
+	expiry := time.Unix(1700000000, 0)
+	hostname, _ := os.Hostname()
+
+	got := renderTokenName("", "work", expiry)
+	want := "cf-vault-work-" + currentUsername() + "@" + hostname + "-1700000000"
+	if got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+
+	got = renderTokenName("{profile}-{random}-{random}", "work", expiry)
+	if !regexp.MustCompile(`^work-[0-9a-f]{6}-[0-9a-f]{6}$`).MatchString(got) {
+		t.Errorf("expected random suffixes, got %q", got)
+	}
+	if parts := strings.Split(got, "-"); parts[1] == parts[2] {
+		t.Errorf("expected each {random} to differ, got %q", got)
+	}
+}
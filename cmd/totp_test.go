@@ -0,0 +1,95 @@
+package cmd
+
+import (
+	"encoding/base32"
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfc6238Secret is the SHA1 key from the RFC 6238 test vectors.
+var rfc6238Secret = base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+
+func TestTOTPCode(t *testing.T) {
+	// RFC 6238 appendix B, truncated to 6 digits.
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+
+	for _, tt := range tests {
+		got, err := totpCode(rfc6238Secret, time.Unix(tt.unix, 0))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("totpCode at %d = %s, want %s", tt.unix, got, tt.want)
+		}
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+
+	tests := []struct {
+		name string
+		code string
+		want bool
+	}{
+		{"current", "050471", true},
+		{"previous period", mustTOTPCode(t, now.Add(-totpPeriod)), true},
+		{"next period", mustTOTPCode(t, now.Add(totpPeriod)), true},
+		{"too old", mustTOTPCode(t, now.Add(-3*totpPeriod)), false},
+		{"wrong", "000000", false},
+		{"too short", "05047", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := validateTOTP(rfc6238Secret, tt.code, now)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("validateTOTP(%q) = %v, want %v", tt.code, got, tt.want)
+			}
+		})
+	}
+}
+
+func mustTOTPCode(t *testing.T, at time.Time) string {
+	t.Helper()
+	code, err := totpCode(rfc6238Secret, at)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return code
+}
+
+func TestGenerateTOTPSecret(t *testing.T) {
+	secret, err := generateTOTPSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(secret) != 32 {
+		t.Errorf("expected a 32 character base32 secret, got %q", secret)
+	}
+	if _, err := totpCode(secret, time.Now()); err != nil {
+		t.Errorf("expected the secret to be usable, got %v", err)
+	}
+}
+
+func TestTOTPURI(t *testing.T) {
+	uri := totpURI("production", "JBSWY3DPEHPK3PXP")
+	for _, want := range []string{"otpauth://totp/cf-vault:production?", "secret=JBSWY3DPEHPK3PXP", "issuer=cf-vault", "digits=6", "period=30"} {
+		if !strings.Contains(uri, want) {
+			t.Errorf("expected %q in %s", want, uri)
+		}
+	}
+}
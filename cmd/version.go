@@ -21,7 +21,9 @@ var versionCmd = &cobra.Command{
 			log.SetLevel(log.DebugLevel)
 		}
 	},
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
 		fmt.Printf("%s %s (%s,%s-%s)", projectName, Rev, runtime.Version(), runtime.Compiler, runtime.GOARCH)
+
+		return nil
 	},
 }
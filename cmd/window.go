@@ -0,0 +1,151 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	// Windows doesn't ship a timezone database so embed one for timezone.
+	_ "time/tzdata"
+)
+
+// weekdayNames maps the accepted names of days to their time.Weekday.
+var weekdayNames = map[string]time.Weekday{
+	"sun": time.Sunday, "sunday": time.Sunday,
+	"mon": time.Monday, "monday": time.Monday,
+	"tue": time.Tuesday, "tuesday": time.Tuesday,
+	"wed": time.Wednesday, "wednesday": time.Wednesday,
+	"thu": time.Thursday, "thursday": time.Thursday,
+	"fri": time.Friday, "friday": time.Friday,
+	"sat": time.Saturday, "saturday": time.Saturday,
+}
+
+// usageWindow restricts when a profile can be used.
+type usageWindow struct {
+	// Days the window opens on, every day when empty.
+	Days []string `toml:"days,omitempty"`
+	// Start and End are the "HH:MM" times the window opens and closes, the
+	// whole day when both are empty. A window which ends before it starts
+	// runs overnight into the following day.
+	Start string `toml:"start,omitempty"`
+	End   string `toml:"end,omitempty"`
+	// Timezone is the IANA name of the zone the window is in, the local zone
+	// when empty.
+	Timezone string `toml:"timezone,omitempty"`
+}
+
+// parseClock parses an "HH:MM" time into minutes after midnight.
+func parseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q, expected HH:MM", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// location returns the window's timezone. time.LoadLocation treats an empty
+// name as UTC so the local zone is handled here.
+func (w *usageWindow) location() (*time.Location, error) {
+	if w.Timezone == "" {
+		return time.Local, nil
+	}
+	return time.LoadLocation(w.Timezone)
+}
+
+// validate checks the days, times and timezone can be parsed.
+func (w *usageWindow) validate() error {
+	if w == nil {
+		return nil
+	}
+
+	for _, d := range w.Days {
+		if _, ok := weekdayNames[strings.ToLower(d)]; !ok {
+			return fmt.Errorf("allowed_window: unknown day %q", d)
+		}
+	}
+
+	if (w.Start == "") != (w.End == "") {
+		return fmt.Errorf("allowed_window: start and end must be set together")
+	}
+	if w.Start != "" {
+		start, err := parseClock(w.Start)
+		if err != nil {
+			return fmt.Errorf("allowed_window: %w", err)
+		}
+		end, err := parseClock(w.End)
+		if err != nil {
+			return fmt.Errorf("allowed_window: %w", err)
+		}
+		if start == end {
+			return fmt.Errorf("allowed_window: start and end cannot be the same")
+		}
+	}
+
+	if _, err := w.location(); err != nil {
+		return fmt.Errorf("allowed_window: unknown timezone %q", w.Timezone)
+	}
+
+	return nil
+}
+
+// opensOn reports whether the window opens on day.
+func (w *usageWindow) opensOn(day time.Weekday) bool {
+	if len(w.Days) == 0 {
+		return true
+	}
+	for _, d := range w.Days {
+		if weekdayNames[strings.ToLower(d)] == day {
+			return true
+		}
+	}
+	return false
+}
+
+// contains reports whether t falls inside the window. A nil window always
+// contains t. The window must have been validated.
+func (w *usageWindow) contains(t time.Time) bool {
+	if w == nil {
+		return true
+	}
+
+	loc, _ := w.location()
+	t = t.In(loc)
+
+	if w.Start == "" {
+		return w.opensOn(t.Weekday())
+	}
+
+	start, _ := parseClock(w.Start)
+	end, _ := parseClock(w.End)
+	now := t.Hour()*60 + t.Minute()
+
+	if start < end {
+		return w.opensOn(t.Weekday()) && now >= start && now < end
+	}
+
+	// Overnight windows belong to the day they open on.
+	if now >= start {
+		return w.opensOn(t.Weekday())
+	}
+	return now < end && w.opensOn(t.AddDate(0, 0, -1).Weekday())
+}
+
+// String describes the window for error messages.
+func (w *usageWindow) String() string {
+	days := "every day"
+	if len(w.Days) > 0 {
+		days = "on " + strings.Join(w.Days, ", ")
+	}
+
+	hours := ""
+	if w.Start != "" {
+		hours = fmt.Sprintf(" between %s and %s", w.Start, w.End)
+	}
+
+	zone := w.Timezone
+	if zone == "" {
+		zone = "local time"
+	}
+
+	return fmt.Sprintf("%s%s (%s)", days, hours, zone)
+}
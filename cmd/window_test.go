@@ -0,0 +1,93 @@
+package cmd
+
+import (
+	"testing"
+	"time"
+)
+
+func TestUsageWindowValidate(t *testing.T) {
+	valid := []*usageWindow{
+		nil,
+		{Days: []string{"Mon", "tuesday"}},
+		{Start: "09:00", End: "17:00", Timezone: "Australia/Sydney"},
+		{Start: "22:00", End: "06:00"},
+	}
+	for _, w := range valid {
+		if err := w.validate(); err != nil {
+			t.Errorf("expected %+v to be valid, got %v", w, err)
+		}
+	}
+
+	invalid := []*usageWindow{
+		{Days: []string{"someday"}},
+		{Start: "09:00"},
+		{Start: "9am", End: "5pm"},
+		{Start: "09:00", End: "09:00"},
+		{Timezone: "Mars/Olympus_Mons"},
+	}
+	for _, w := range invalid {
+		if err := w.validate(); err == nil {
+			t.Errorf("expected %+v to be invalid", w)
+		}
+	}
+}
+
+func TestUsageWindowContains(t *testing.T) {
+	businessHours := &usageWindow{Days: []string{"mon", "tue", "wed", "thu", "fri"}, Start: "09:00", End: "17:00", Timezone: "UTC"}
+	overnight := &usageWindow{Days: []string{"fri"}, Start: "22:00", End: "06:00", Timezone: "UTC"}
+	sydney := &usageWindow{Start: "09:00", End: "17:00", Timezone: "Australia/Sydney"}
+
+	tests := []struct {
+		name   string
+		window *usageWindow
+		at     string
+		want   bool
+	}{
+		{"no window", nil, "2026-10-18T03:00:00Z", true},
+		{"weekday inside", businessHours, "2026-10-14T10:00:00Z", true},
+		{"weekday before", businessHours, "2026-10-14T08:59:00Z", false},
+		{"weekday at close", businessHours, "2026-10-14T17:00:00Z", false},
+		{"weekend", businessHours, "2026-10-17T10:00:00Z", false},
+		{"overnight evening", overnight, "2026-10-16T23:00:00Z", true},
+		{"overnight following morning", overnight, "2026-10-17T05:00:00Z", true},
+		{"overnight wrong day", overnight, "2026-10-15T23:00:00Z", false},
+		{"overnight after close", overnight, "2026-10-17T07:00:00Z", false},
+		{"timezone inside", sydney, "2026-10-14T00:00:00Z", true},
+		{"timezone outside", sydney, "2026-10-14T10:00:00Z", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			at, err := time.Parse(time.RFC3339, tt.at)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := tt.window.contains(at); got != tt.want {
+				t.Errorf("contains(%s) = %v, want %v", tt.at, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUsageWindowContains_LocalTimezone(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func(loc *time.Location) { time.Local = loc }(time.Local)
+	time.Local = newYork
+
+	w := &usageWindow{Start: "09:00", End: "17:00"}
+	if err := w.validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 10:00 in New York, outside the window in UTC.
+	if at := time.Date(2026, 10, 14, 10, 0, 0, 0, newYork); !w.contains(at) {
+		t.Errorf("expected %s to be inside a window in the local timezone", at)
+	}
+	// 10:00 UTC, 06:00 in New York.
+	if at := time.Date(2026, 10, 14, 10, 0, 0, 0, time.UTC); w.contains(at) {
+		t.Errorf("expected %s to be outside a window in the local timezone", at)
+	}
+}
@@ -14,6 +14,7 @@ require (
 	golang.org/x/lint v0.0.0-20210508222113-6edffad5e616
 	golang.org/x/term v0.43.0
 	golang.org/x/tools/gopls v0.22.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (